@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (interpreter *Interpreter) visitAssertStmt(stmt *StmtAssert) error {
+	// Assertions in the functions called keep their own values
+	enclosingValues := interpreter.assertValues
+	interpreter.assertValues = map[Expr]any{}
+	defer func() {
+		interpreter.assertValues = enclosingValues
+	}()
+
+	value, err := interpreter.evaluate(stmt.condition)
+	if err != nil {
+		return err
+	}
+	if isTruthy(value) {
+		return nil
+	}
+	details := assertDetails(stmt.condition, interpreter.assertValues)
+
+	message := "Assertion failed."
+	if stmt.message != nil {
+		value, err := interpreter.evaluate(stmt.message)
+		if err != nil {
+			return err
+		}
+		message = "Assertion failed: " + string(stringify(value))
+	}
+	return NewRuntimeError(stmt.keyword, message).WithDetails(details)
+}
+
+// Tests are run by `glox test`, running the script only declares them
+func (interpreter *Interpreter) visitTestStmt(stmt *StmtTest) error {
+	return nil
+}
+
+// The asserted expression followed by the values its operands produced,
+// the expression itself is only listed when it has no operand to show
+func assertDetails(condition Expr, values map[Expr]any) []string {
+	details := []string{"assert " + exprSource(condition)}
+	operands := assertOperands(condition)
+	if len(operands) > 1 {
+		operands = operands[1:]
+	}
+	for _, operand := range operands {
+		if value, ok := values[operand]; ok {
+			details = append(details, fmt.Sprintf("%v = %v", exprSource(operand), debugValue(value)))
+		}
+	}
+	return details
+}
+
+// The expressions worth showing the value of in source order, literals are left out
+// and function bodies aren't part of the assertion
+func assertOperands(expr Expr) []Expr {
+	operands := []Expr{}
+	var walk func(expr Expr)
+	walk = func(expr Expr) {
+		switch expr := expr.(type) {
+		case *ExprLiteral, *ExprFunction:
+			return
+		case *ExprGrouping:
+			walk(expr.expression)
+			return
+		}
+		operands = append(operands, expr)
+		for i, child := range exprChildren(expr) {
+			// The function called by name is obvious from the source
+			if _, ok := child.(*ExprVariable); ok && i == 0 && isCall(expr) {
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(expr)
+	return operands
+}
+
+func isCall(expr Expr) bool {
+	_, ok := expr.(*ExprCall)
+	return ok
+}
+
+func exprChildren(expr Expr) []Expr {
+	children := []Expr{}
+	walkChildren(expr, func(child any) {
+		if child, ok := child.(Expr); ok {
+			children = append(children, child)
+		}
+	})
+	return children
+}
+
+// Prints an expression back to Lox on a single line, function bodies are elided
+type SourcePrinter struct{}
+
+func exprSource(expr Expr) string {
+	source, _ := expr.accept(SourcePrinter{})
+	return source.(string)
+}
+
+func (p SourcePrinter) list(exprs []Expr) string {
+	items := []string{}
+	for _, expr := range exprs {
+		items = append(items, exprSource(expr))
+	}
+	return strings.Join(items, ", ")
+}
+
+func (p SourcePrinter) visitAssignExpr(expr *ExprAssign) (any, error) {
+	return expr.name.Lexeme + " = " + exprSource(expr.value), nil
+}
+
+func (p SourcePrinter) visitBinaryExpr(expr *ExprBinary) (any, error) {
+	if expr.operator.Type == Comma {
+		return exprSource(expr.left) + ", " + exprSource(expr.right), nil
+	}
+	return exprSource(expr.left) + " " + expr.operator.Lexeme + " " + exprSource(expr.right), nil
+}
+
+func (p SourcePrinter) visitFunctionExpr(expr *ExprFunction) (any, error) {
+	params := []string{}
+	for _, param := range expr.params {
+		params = append(params, param.Lexeme)
+	}
+	return fmt.Sprintf("fun (%v) { ... }", strings.Join(params, ", ")), nil
+}
+
+func (p SourcePrinter) visitArrayExpr(expr *ExprArray) (any, error) {
+	return exprSource(expr.array) + "[" + exprSource(expr.index) + "]", nil
+}
+
+func (p SourcePrinter) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
+	return "Array{" + p.list(expr.arguments) + "}", nil
+}
+
+func (p SourcePrinter) visitCallExpr(expr *ExprCall) (any, error) {
+	return exprSource(expr.callee) + "(" + p.list(expr.arguments) + ")", nil
+}
+
+func (p SourcePrinter) visitGetExpr(expr *ExprGet) (any, error) {
+	return exprSource(expr.object) + "." + expr.name.Lexeme, nil
+}
+
+func (p SourcePrinter) visitTernaryExpr(expr *ExprTernary) (any, error) {
+	return exprSource(expr.condition) + " ? " + exprSource(expr.left) + " : " + exprSource(expr.right), nil
+}
+
+func (p SourcePrinter) visitGroupingExpr(expr *ExprGrouping) (any, error) {
+	return "(" + exprSource(expr.expression) + ")", nil
+}
+
+func (p SourcePrinter) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	return debugValue(expr.value), nil
+}
+
+func (p SourcePrinter) visitLogicalExpr(expr *ExprLogical) (any, error) {
+	return exprSource(expr.left) + " " + expr.operator.Lexeme + " " + exprSource(expr.right), nil
+}
+
+func (p SourcePrinter) visitSetExpr(expr *ExprSet) (any, error) {
+	return exprSource(expr.object) + "." + expr.name.Lexeme + " = " + exprSource(expr.value), nil
+}
+
+func (p SourcePrinter) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
+	return exprSource(expr.object) + "[" + exprSource(expr.index) + "] = " + exprSource(expr.value), nil
+}
+
+func (p SourcePrinter) visitSuperExpr(expr *ExprSuper) (any, error) {
+	return "super." + expr.method.Lexeme, nil
+}
+
+func (p SourcePrinter) visitThisExpr(expr *ExprThis) (any, error) {
+	return "this", nil
+}
+
+func (p SourcePrinter) visitUnaryExpr(expr *ExprUnary) (any, error) {
+	return expr.operator.Lexeme + exprSource(expr.right), nil
+}
+
+func (p SourcePrinter) visitVariableExpr(expr *ExprVariable) (any, error) {
+	return expr.name.Lexeme, nil
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+func astCommand(args []string) error {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox ast [flags] [script]")
+		fmt.Fprintln(os.Stderr, "Prints the syntax tree of the script, or of the standard input, as parsed before the resolution")
+		fmt.Fprintln(os.Stderr, "The JSON has the span of every node and the DOT output renders with `dot -Tsvg`")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "sexpr", "output `format`: sexpr, json or dot")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if *format != "sexpr" && *format != "json" && *format != "dot" {
+		return fmt.Errorf("Unknown format '%v', expect sexpr, json or dot.", *format)
+	}
+
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var source []byte
+	if flags.NArg() == 0 {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	reporter := NewErrorReporter(os.Stderr)
+	stmts, _, err := parseSource(string(source), SourceConfig(string(source), &GlobalConfig, reporter), reporter, false, false)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(NewAstBuilder(string(source)).program(stmts))
+	case "dot":
+		_, err = io.WriteString(os.Stdout, astDot(NewAstBuilder(string(source)).program(stmts)))
+		return err
+	}
+	fmt.Println(NewAstPrinter().printStmts(stmts))
+	return nil
+}
+
+// A node of the syntax tree in a generic shape, the type is the name of the Go struct
+type AstNode struct {
+	Type string
+	// `nil` when the node keeps no token, e.g. the `true` condition made up for `for (;;)`
+	Span   *AstSpan
+	Fields []AstField
+}
+
+// The value is a *AstToken, a *AstNode, a list of them or the value of a literal,
+// fields without a value in the tree are left out rather than set to `nil`
+type AstField struct {
+	Name  string
+	Value any
+}
+
+type AstToken struct {
+	Lexeme string `json:"lexeme"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+}
+
+// From the start of the first token kept by the node or its children to the end of the last one,
+// the nodes keep their leading keywords and their closing `;`, braces, brackets and parentheses
+type AstSpan struct {
+	Start AstPosition `json:"start"`
+	End   AstPosition `json:"end"`
+}
+
+// Lines and columns start at 1, columns and offsets are in bytes
+type AstPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// Keeps the order of the fields, `type` and `span` first
+func (node *AstNode) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(`{"type":`)
+	typeName, _ := json.Marshal(node.Type)
+	buffer.Write(typeName)
+	if node.Span != nil {
+		span, _ := json.Marshal(node.Span)
+		buffer.WriteString(`,"span":`)
+		buffer.Write(span)
+	}
+	for _, field := range node.Fields {
+		value, err := json.Marshal(astJSONValue(field.Value))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buffer, `,%q:`, field.Name)
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// Lox strings are bytes, they are written as JSON strings rather than base64
+func astJSONValue(value any) any {
+	if value, ok := value.([]byte); ok {
+		return string(value)
+	}
+	return value
+}
+
+// Turns the statements into generic nodes, the source gives the columns of the tokens
+type AstBuilder struct {
+	source string
+	// Offsets where the lines start
+	lines []int
+	// Statements don't return a value so they are stored here
+	node *AstNode
+}
+
+func NewAstBuilder(source string) *AstBuilder {
+	lines := []int{0}
+	for i := range source {
+		if source[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &AstBuilder{source: source, lines: lines}
+}
+
+func (b *AstBuilder) program(stmts []Stmt) *AstNode {
+	return b.newNode("Program", AstField{"body", b.stmts(stmts)})
+}
+
+func (b *AstBuilder) position(offset int) AstPosition {
+	line, found := slices.BinarySearch(b.lines, offset)
+	if !found {
+		line--
+	}
+	return AstPosition{Line: line + 1, Column: offset - b.lines[line] + 1, Offset: offset}
+}
+
+func (b *AstBuilder) token(token *Token) *AstToken {
+	position := b.position(token.Offset)
+	return &AstToken{Lexeme: token.Lexeme, Line: token.Line, Column: position.Column, Offset: token.Offset}
+}
+
+func (b *AstBuilder) tokens(tokens []*Token) []*AstToken {
+	list := []*AstToken{}
+	for _, token := range tokens {
+		list = append(list, b.token(token))
+	}
+	return list
+}
+
+func (b *AstBuilder) stmt(stmt Stmt) *AstNode {
+	stmt.accept(b)
+	return b.node
+}
+
+func (b *AstBuilder) stmts(stmts []Stmt) []*AstNode {
+	nodes := []*AstNode{}
+	for _, stmt := range stmts {
+		nodes = append(nodes, b.stmt(stmt))
+	}
+	return nodes
+}
+
+func (b *AstBuilder) expr(expr Expr) *AstNode {
+	node, _ := expr.accept(b)
+	return node.(*AstNode)
+}
+
+func (b *AstBuilder) exprs(exprs []Expr) []*AstNode {
+	nodes := []*AstNode{}
+	for _, expr := range exprs {
+		nodes = append(nodes, b.expr(expr))
+	}
+	return nodes
+}
+
+// The fields set to `nil` are left out and the span covers the tokens and the children
+func (b *AstBuilder) newNode(nodeType string, fields ...AstField) *AstNode {
+	node := &AstNode{Type: nodeType, Fields: []AstField{}}
+	include := func(start, end int) {
+		if node.Span == nil {
+			node.Span = &AstSpan{Start: b.position(start), End: b.position(end)}
+			return
+		}
+		if start < node.Span.Start.Offset {
+			node.Span.Start = b.position(start)
+		}
+		if end > node.Span.End.Offset {
+			node.Span.End = b.position(end)
+		}
+	}
+	includeNode := func(child *AstNode) {
+		if child.Span != nil {
+			include(child.Span.Start.Offset, child.Span.End.Offset)
+		}
+	}
+
+	for _, field := range fields {
+		switch value := field.Value.(type) {
+		case *Token:
+			if value == nil {
+				continue
+			}
+			include(value.Offset, value.Offset+len(value.Lexeme))
+			field.Value = b.token(value)
+		case []*Token:
+			for _, token := range value {
+				include(token.Offset, token.Offset+len(token.Lexeme))
+			}
+			field.Value = b.tokens(value)
+		case *AstNode:
+			if value == nil {
+				continue
+			}
+			includeNode(value)
+		case []*AstNode:
+			for _, child := range value {
+				includeNode(child)
+			}
+		}
+		node.Fields = append(node.Fields, field)
+	}
+	return node
+}
+
+// Optional children are `nil` fields once built so [newNode] leaves them out
+func (b *AstBuilder) optionalExpr(expr Expr) *AstNode {
+	if expr == nil {
+		return nil
+	}
+	return b.expr(expr)
+}
+
+func (b *AstBuilder) optionalStmt(stmt Stmt) *AstNode {
+	if stmt == nil {
+		return nil
+	}
+	return b.stmt(stmt)
+}
+
+func (b *AstBuilder) functions(functions []*StmtFunction) []*AstNode {
+	nodes := []*AstNode{}
+	for _, function := range functions {
+		nodes = append(nodes, b.stmt(function))
+	}
+	return nodes
+}
+
+func (b *AstBuilder) visitBlockStmt(stmt *StmtBlock) error {
+	b.node = b.newNode("StmtBlock", AstField{"brace", stmt.brace}, AstField{"statements", b.stmts(stmt.block)}, AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitClassStmt(stmt *StmtClass) error {
+	var superclass *AstNode
+	if stmt.superclass != nil {
+		superclass = b.expr(stmt.superclass)
+	}
+	b.node = b.newNode("StmtClass",
+		AstField{"keyword", stmt.keyword},
+		AstField{"name", stmt.name},
+		AstField{"superclass", superclass},
+		AstField{"methods", b.functions(stmt.methods)},
+		AstField{"staticMethods", b.functions(stmt.staticMethods)},
+		AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitExpressionStmt(stmt *StmtExpression) error {
+	b.node = b.newNode("StmtExpression", AstField{"first", stmt.first}, AstField{"expression", b.expr(stmt.expression)}, AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitFunctionStmt(stmt *StmtFunction) error {
+	b.node = b.newNode("StmtFunction", AstField{"keyword", stmt.keyword}, AstField{"name", stmt.name}, AstField{"function", b.expr(stmt.function)})
+	return nil
+}
+
+func (b *AstBuilder) visitIfStmt(stmt *StmtIf) error {
+	b.node = b.newNode("StmtIf",
+		AstField{"keyword", stmt.keyword},
+		AstField{"condition", b.expr(stmt.condition)},
+		AstField{"thenBranch", b.stmt(stmt.thenBranch)},
+		AstField{"elseBranch", b.optionalStmt(stmt.elseBranch)})
+	return nil
+}
+
+func (b *AstBuilder) visitPrintStmt(stmt *StmtPrint) error {
+	b.node = b.newNode("StmtPrint", AstField{"keyword", stmt.keyword}, AstField{"expression", b.expr(stmt.expression)}, AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitReturnStmt(stmt *StmtReturn) error {
+	b.node = b.newNode("StmtReturn",
+		AstField{"keyword", stmt.keyword},
+		AstField{"expression", b.optionalExpr(stmt.expression)},
+		AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitVarStmt(stmt *StmtVar) error {
+	b.node = b.newNode("StmtVar",
+		AstField{"keyword", stmt.keyword},
+		AstField{"name", stmt.name},
+		AstField{"initializer", b.optionalExpr(stmt.initializer)},
+		AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitLoopStmt(stmt *StmtLoop) error {
+	b.node = b.newNode("StmtLoop",
+		AstField{"keyword", stmt.keyword},
+		AstField{"condition", b.expr(stmt.condition)},
+		AstField{"increment", b.optionalExpr(stmt.increment)},
+		AstField{"body", b.stmt(stmt.body)})
+	return nil
+}
+
+func (b *AstBuilder) visitBreakStmt(stmt *StmtBreak) error {
+	b.node = b.newNode("StmtBreak", AstField{"keyword", stmt.keyword}, AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitContinueStmt(stmt *StmtContinue) error {
+	b.node = b.newNode("StmtContinue", AstField{"keyword", stmt.keyword}, AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitAssertStmt(stmt *StmtAssert) error {
+	b.node = b.newNode("StmtAssert",
+		AstField{"keyword", stmt.keyword},
+		AstField{"condition", b.expr(stmt.condition)},
+		AstField{"message", b.optionalExpr(stmt.message)},
+		AstField{"end", stmt.end})
+	return nil
+}
+
+func (b *AstBuilder) visitTestStmt(stmt *StmtTest) error {
+	b.node = b.newNode("StmtTest", AstField{"keyword", stmt.keyword}, AstField{"name", stmt.name}, AstField{"body", b.stmt(stmt.body)})
+	return nil
+}
+
+func (b *AstBuilder) visitAssignExpr(expr *ExprAssign) (any, error) {
+	return b.newNode("ExprAssign", AstField{"name", expr.name}, AstField{"value", b.expr(expr.value)}), nil
+}
+
+func (b *AstBuilder) visitBinaryExpr(expr *ExprBinary) (any, error) {
+	return b.newNode("ExprBinary",
+		AstField{"left", b.expr(expr.left)},
+		AstField{"operator", expr.operator},
+		AstField{"right", b.expr(expr.right)}), nil
+}
+
+// Getters have no parameter list, unlike the functions without parameters
+func (b *AstBuilder) visitFunctionExpr(expr *ExprFunction) (any, error) {
+	fields := []AstField{{"keyword", expr.keyword}}
+	if expr.params != nil {
+		fields = append(fields, AstField{"params", expr.params})
+	}
+	fields = append(fields, AstField{"body", b.stmts(expr.body)}, AstField{"end", expr.end})
+	return b.newNode("ExprFunction", fields...), nil
+}
+
+func (b *AstBuilder) visitArrayExpr(expr *ExprArray) (any, error) {
+	return b.newNode("ExprArray",
+		AstField{"array", b.expr(expr.array)},
+		AstField{"bracket", expr.bracket},
+		AstField{"index", b.expr(expr.index)},
+		AstField{"end", expr.end}), nil
+}
+
+func (b *AstBuilder) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
+	return b.newNode("ExprArrayInstance",
+		AstField{"keyword", expr.keyword},
+		AstField{"arguments", b.exprs(expr.arguments)},
+		AstField{"end", expr.end}), nil
+}
+
+func (b *AstBuilder) visitCallExpr(expr *ExprCall) (any, error) {
+	return b.newNode("ExprCall",
+		AstField{"callee", b.expr(expr.callee)},
+		AstField{"paren", expr.paren},
+		AstField{"arguments", b.exprs(expr.arguments)}), nil
+}
+
+func (b *AstBuilder) visitGetExpr(expr *ExprGet) (any, error) {
+	return b.newNode("ExprGet", AstField{"object", b.expr(expr.object)}, AstField{"name", expr.name}), nil
+}
+
+func (b *AstBuilder) visitTernaryExpr(expr *ExprTernary) (any, error) {
+	return b.newNode("ExprTernary",
+		AstField{"condition", b.expr(expr.condition)},
+		AstField{"operator", expr.operator},
+		AstField{"left", b.expr(expr.left)},
+		AstField{"right", b.expr(expr.right)}), nil
+}
+
+func (b *AstBuilder) visitGroupingExpr(expr *ExprGrouping) (any, error) {
+	return b.newNode("ExprGrouping", AstField{"paren", expr.paren}, AstField{"expression", b.expr(expr.expression)}, AstField{"end", expr.end}), nil
+}
+
+// The value is kept even when `nil`, it is then the `nil` literal
+func (b *AstBuilder) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	node := b.newNode("ExprLiteral", AstField{"token", expr.token})
+	node.Fields = append(node.Fields, AstField{"value", expr.value})
+	return node, nil
+}
+
+func (b *AstBuilder) visitLogicalExpr(expr *ExprLogical) (any, error) {
+	return b.newNode("ExprLogical",
+		AstField{"left", b.expr(expr.left)},
+		AstField{"operator", expr.operator},
+		AstField{"right", b.expr(expr.right)}), nil
+}
+
+func (b *AstBuilder) visitSetExpr(expr *ExprSet) (any, error) {
+	return b.newNode("ExprSet",
+		AstField{"object", b.expr(expr.object)},
+		AstField{"name", expr.name},
+		AstField{"value", b.expr(expr.value)}), nil
+}
+
+func (b *AstBuilder) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
+	return b.newNode("ExprSetArray",
+		AstField{"name", expr.name},
+		AstField{"object", b.expr(expr.object)},
+		AstField{"index", b.expr(expr.index)},
+		AstField{"value", b.expr(expr.value)}), nil
+}
+
+func (b *AstBuilder) visitSuperExpr(expr *ExprSuper) (any, error) {
+	return b.newNode("ExprSuper", AstField{"keyword", expr.keyword}, AstField{"method", expr.method}), nil
+}
+
+func (b *AstBuilder) visitThisExpr(expr *ExprThis) (any, error) {
+	return b.newNode("ExprThis", AstField{"keyword", expr.keyword}), nil
+}
+
+func (b *AstBuilder) visitUnaryExpr(expr *ExprUnary) (any, error) {
+	return b.newNode("ExprUnary", AstField{"operator", expr.operator}, AstField{"right", b.expr(expr.right)}), nil
+}
+
+func (b *AstBuilder) visitVariableExpr(expr *ExprVariable) (any, error) {
+	return b.newNode("ExprVariable", AstField{"name", expr.name}), nil
+}
+
+// Graphviz digraph of the nodes, the tokens and literal values are part of the labels
+// and the edges are named after the fields, with the index for the lists
+func astDot(root *AstNode) string {
+	var builder strings.Builder
+	builder.WriteString("digraph ast {\n")
+	builder.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	count := 0
+	var write func(node *AstNode) int
+	write = func(node *AstNode) int {
+		id := count
+		count++
+		label := []string{node.Type}
+		for _, field := range node.Fields {
+			switch value := field.Value.(type) {
+			case *AstNode, []*AstNode:
+			case *AstToken:
+				label = append(label, field.Name+": "+value.Lexeme)
+			case []*AstToken:
+				lexemes := []string{}
+				for _, token := range value {
+					lexemes = append(lexemes, token.Lexeme)
+				}
+				label = append(label, field.Name+": ("+strings.Join(lexemes, ", ")+")")
+			default:
+				label = append(label, field.Name+": "+debugValue(value))
+			}
+		}
+		if node.Span != nil {
+			label = append(label, fmt.Sprintf("%d:%d-%d:%d", node.Span.Start.Line, node.Span.Start.Column, node.Span.End.Line, node.Span.End.Column))
+		}
+		fmt.Fprintf(&builder, "  n%d [label=%v];\n", id, dotQuote(strings.Join(label, "\n")))
+
+		edge := func(child *AstNode, name string) {
+			childId := write(child)
+			fmt.Fprintf(&builder, "  n%d -> n%d [label=%v];\n", id, childId, dotQuote(name))
+		}
+		for _, field := range node.Fields {
+			switch value := field.Value.(type) {
+			case *AstNode:
+				edge(value, field.Name)
+			case []*AstNode:
+				for i, child := range value {
+					edge(child, fmt.Sprintf("%v[%d]", field.Name, i))
+				}
+			}
+		}
+		return id
+	}
+	write(root)
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+func dotQuote(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, "\"", "\\\"")
+	return "\"" + strings.ReplaceAll(text, "\n", "\\n") + "\""
+}
@@ -0,0 +1,303 @@
+// Code generated by generate_ast.go. DO NOT EDIT.
+
+package main
+
+// Calls [visit] on the Stmt and Expr children of [node] in source order, `nil` ones are skipped
+func walkChildren(node any, visit func(child any)) {
+	switch node := node.(type) {
+	case *ExprAssign:
+		if node.value != nil {
+			visit(node.value)
+		}
+	case *ExprBinary:
+		if node.left != nil {
+			visit(node.left)
+		}
+		if node.right != nil {
+			visit(node.right)
+		}
+	case *ExprFunction:
+		for _, child := range node.body {
+			visit(child)
+		}
+	case *ExprArray:
+		if node.array != nil {
+			visit(node.array)
+		}
+		if node.index != nil {
+			visit(node.index)
+		}
+	case *ExprArrayInstance:
+		for _, child := range node.arguments {
+			visit(child)
+		}
+	case *ExprCall:
+		if node.callee != nil {
+			visit(node.callee)
+		}
+		for _, child := range node.arguments {
+			visit(child)
+		}
+	case *ExprGet:
+		if node.object != nil {
+			visit(node.object)
+		}
+	case *ExprTernary:
+		if node.condition != nil {
+			visit(node.condition)
+		}
+		if node.left != nil {
+			visit(node.left)
+		}
+		if node.right != nil {
+			visit(node.right)
+		}
+	case *ExprGrouping:
+		if node.expression != nil {
+			visit(node.expression)
+		}
+	case *ExprLogical:
+		if node.left != nil {
+			visit(node.left)
+		}
+		if node.right != nil {
+			visit(node.right)
+		}
+	case *ExprSet:
+		if node.object != nil {
+			visit(node.object)
+		}
+		if node.value != nil {
+			visit(node.value)
+		}
+	case *ExprSetArray:
+		if node.object != nil {
+			visit(node.object)
+		}
+		if node.index != nil {
+			visit(node.index)
+		}
+		if node.value != nil {
+			visit(node.value)
+		}
+	case *ExprUnary:
+		if node.right != nil {
+			visit(node.right)
+		}
+	case *StmtBlock:
+		for _, child := range node.block {
+			visit(child)
+		}
+	case *StmtClass:
+		if node.superclass != nil {
+			visit(node.superclass)
+		}
+		for _, child := range node.methods {
+			visit(child)
+		}
+		for _, child := range node.staticMethods {
+			visit(child)
+		}
+	case *StmtFunction:
+		if node.function != nil {
+			visit(node.function)
+		}
+	case *StmtIf:
+		if node.condition != nil {
+			visit(node.condition)
+		}
+		if node.thenBranch != nil {
+			visit(node.thenBranch)
+		}
+		if node.elseBranch != nil {
+			visit(node.elseBranch)
+		}
+	case *StmtExpression:
+		if node.expression != nil {
+			visit(node.expression)
+		}
+	case *StmtPrint:
+		if node.expression != nil {
+			visit(node.expression)
+		}
+	case *StmtReturn:
+		if node.expression != nil {
+			visit(node.expression)
+		}
+	case *StmtVar:
+		if node.initializer != nil {
+			visit(node.initializer)
+		}
+	case *StmtLoop:
+		if node.condition != nil {
+			visit(node.condition)
+		}
+		if node.increment != nil {
+			visit(node.increment)
+		}
+		if node.body != nil {
+			visit(node.body)
+		}
+	case *StmtAssert:
+		if node.condition != nil {
+			visit(node.condition)
+		}
+		if node.message != nil {
+			visit(node.message)
+		}
+	case *StmtTest:
+		if node.body != nil {
+			visit(node.body)
+		}
+	}
+}
+
+// Replaces the Stmt and Expr children of [node] by what [rewrite] returns for them
+func rewriteChildren(node any, rewrite func(child any) any) {
+	switch node := node.(type) {
+	case *ExprAssign:
+		if node.value != nil {
+			node.value = rewrite(node.value).(Expr)
+		}
+	case *ExprBinary:
+		if node.left != nil {
+			node.left = rewrite(node.left).(Expr)
+		}
+		if node.right != nil {
+			node.right = rewrite(node.right).(Expr)
+		}
+	case *ExprFunction:
+		for i, child := range node.body {
+			node.body[i] = rewrite(child).(Stmt)
+		}
+	case *ExprArray:
+		if node.array != nil {
+			node.array = rewrite(node.array).(Expr)
+		}
+		if node.index != nil {
+			node.index = rewrite(node.index).(Expr)
+		}
+	case *ExprArrayInstance:
+		for i, child := range node.arguments {
+			node.arguments[i] = rewrite(child).(Expr)
+		}
+	case *ExprCall:
+		if node.callee != nil {
+			node.callee = rewrite(node.callee).(Expr)
+		}
+		for i, child := range node.arguments {
+			node.arguments[i] = rewrite(child).(Expr)
+		}
+	case *ExprGet:
+		if node.object != nil {
+			node.object = rewrite(node.object).(Expr)
+		}
+	case *ExprTernary:
+		if node.condition != nil {
+			node.condition = rewrite(node.condition).(Expr)
+		}
+		if node.left != nil {
+			node.left = rewrite(node.left).(Expr)
+		}
+		if node.right != nil {
+			node.right = rewrite(node.right).(Expr)
+		}
+	case *ExprGrouping:
+		if node.expression != nil {
+			node.expression = rewrite(node.expression).(Expr)
+		}
+	case *ExprLogical:
+		if node.left != nil {
+			node.left = rewrite(node.left).(Expr)
+		}
+		if node.right != nil {
+			node.right = rewrite(node.right).(Expr)
+		}
+	case *ExprSet:
+		if node.object != nil {
+			node.object = rewrite(node.object).(Expr)
+		}
+		if node.value != nil {
+			node.value = rewrite(node.value).(Expr)
+		}
+	case *ExprSetArray:
+		if node.object != nil {
+			node.object = rewrite(node.object).(Expr)
+		}
+		if node.index != nil {
+			node.index = rewrite(node.index).(Expr)
+		}
+		if node.value != nil {
+			node.value = rewrite(node.value).(Expr)
+		}
+	case *ExprUnary:
+		if node.right != nil {
+			node.right = rewrite(node.right).(Expr)
+		}
+	case *StmtBlock:
+		for i, child := range node.block {
+			node.block[i] = rewrite(child).(Stmt)
+		}
+	case *StmtClass:
+		if node.superclass != nil {
+			node.superclass = rewrite(node.superclass).(*ExprVariable)
+		}
+		for i, child := range node.methods {
+			node.methods[i] = rewrite(child).(*StmtFunction)
+		}
+		for i, child := range node.staticMethods {
+			node.staticMethods[i] = rewrite(child).(*StmtFunction)
+		}
+	case *StmtFunction:
+		if node.function != nil {
+			node.function = rewrite(node.function).(*ExprFunction)
+		}
+	case *StmtIf:
+		if node.condition != nil {
+			node.condition = rewrite(node.condition).(Expr)
+		}
+		if node.thenBranch != nil {
+			node.thenBranch = rewrite(node.thenBranch).(Stmt)
+		}
+		if node.elseBranch != nil {
+			node.elseBranch = rewrite(node.elseBranch).(Stmt)
+		}
+	case *StmtExpression:
+		if node.expression != nil {
+			node.expression = rewrite(node.expression).(Expr)
+		}
+	case *StmtPrint:
+		if node.expression != nil {
+			node.expression = rewrite(node.expression).(Expr)
+		}
+	case *StmtReturn:
+		if node.expression != nil {
+			node.expression = rewrite(node.expression).(Expr)
+		}
+	case *StmtVar:
+		if node.initializer != nil {
+			node.initializer = rewrite(node.initializer).(Expr)
+		}
+	case *StmtLoop:
+		if node.condition != nil {
+			node.condition = rewrite(node.condition).(Expr)
+		}
+		if node.increment != nil {
+			node.increment = rewrite(node.increment).(Expr)
+		}
+		if node.body != nil {
+			node.body = rewrite(node.body).(Stmt)
+		}
+	case *StmtAssert:
+		if node.condition != nil {
+			node.condition = rewrite(node.condition).(Expr)
+		}
+		if node.message != nil {
+			node.message = rewrite(node.message).(Expr)
+		}
+	case *StmtTest:
+		if node.body != nil {
+			node.body = rewrite(node.body).(*StmtBlock)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+var (
+	binaryOperators  = []TokenType{BangEqual, EqualEqual, Greater, GreaterEqual, Less, LessEqual, Minus, Slash, Star, Percent, Plus, Comma}
+	logicalOperators = []TokenType{And, Or}
+	unaryOperators   = []TokenType{Bang, Minus}
+)
+
+// Runs a syntax tree printed by `glox ast --format=json`, it is resolved and its errors reported like a script's
+func runAstFile(filePath string, interpreter *Interpreter) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	stmts, err := NewAstLoader(interpreter.config).load(data)
+	if err != nil {
+		return err
+	}
+	reporter := NewErrorReporter(interpreter.stderr)
+	NewResolver(interpreter, interpreter.config, reporter).resolveStmts(stmts)
+	if reporter.hadError {
+		return NewParserError(&Token{Type: EOF}, "Can't continue due to previous errors.")
+	}
+	err = interpreter.interpret(stmts)
+	if err != nil {
+		fmt.Fprintln(interpreter.stderr, err)
+	}
+	return err
+}
+
+// Builds the statements back from the JSON of `glox ast --format=json`, the spans are ignored
+// and a token can also be given as its lexeme alone, it is then on line 0
+type AstLoader struct {
+	config *Config
+	// The first error found, building goes on with `nil` nodes and reports it at the end
+	err error
+	// Loops around the node being built in the current function, `break` and `continue` need one
+	loopDepth int
+}
+
+func NewAstLoader(config *Config) *AstLoader {
+	return &AstLoader{config: config}
+}
+
+func (l *AstLoader) load(data []byte) ([]Stmt, error) {
+	var root any
+	err := json.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid syntax tree: %v.", err)
+	}
+	nodeType, fields := l.node(root, "$")
+	if l.err == nil && nodeType != "Program" {
+		l.fail("$", "expect a Program and got %v", nodeType)
+	}
+	stmts := l.stmts(fields, "body", "$")
+	if l.err != nil {
+		return nil, l.err
+	}
+	return stmts, nil
+}
+
+func (l *AstLoader) fail(path string, format string, args ...any) {
+	if l.err == nil {
+		l.err = fmt.Errorf("Invalid syntax tree at %v: %v.", path, fmt.Sprintf(format, args...))
+	}
+}
+
+// The type and the fields of a node, `nil` fields once failed
+func (l *AstLoader) node(value any, path string) (string, map[string]any) {
+	fields, ok := value.(map[string]any)
+	if !ok {
+		l.fail(path, "expect a node")
+		return "", nil
+	}
+	nodeType, ok := fields["type"].(string)
+	if !ok {
+		l.fail(path, "expect a node with a type")
+		return "", nil
+	}
+	return nodeType, fields
+}
+
+func (l *AstLoader) list(fields map[string]any, name, path string) []any {
+	if fields == nil {
+		return nil
+	}
+	value, ok := fields[name]
+	if !ok {
+		return nil
+	}
+	items, ok := value.([]any)
+	if !ok {
+		l.fail(path+"."+name, "expect a list")
+	}
+	return items
+}
+
+func (l *AstLoader) stmts(fields map[string]any, name, path string) []Stmt {
+	stmts := []Stmt{}
+	for i, item := range l.list(fields, name, path) {
+		stmts = append(stmts, l.stmt(item, fmt.Sprintf("%v.%v[%d]", path, name, i)))
+	}
+	return stmts
+}
+
+func (l *AstLoader) exprs(fields map[string]any, name, path string) []Expr {
+	exprs := []Expr{}
+	for i, item := range l.list(fields, name, path) {
+		exprs = append(exprs, l.expr(item, fmt.Sprintf("%v.%v[%d]", path, name, i)))
+	}
+	return exprs
+}
+
+// A token checked by scanning its lexeme, it must be one of [types] when given
+func (l *AstLoader) token(fields map[string]any, name, path string, types ...TokenType) *Token {
+	if fields == nil {
+		return nil
+	}
+	value, ok := fields[name]
+	if !ok {
+		l.fail(path, "expect a '%v' token", name)
+		return nil
+	}
+	return l.tokenValue(value, path+"."+name, types...)
+}
+
+func (l *AstLoader) optionalToken(fields map[string]any, name, path string, types ...TokenType) *Token {
+	if fields == nil || fields[name] == nil {
+		return nil
+	}
+	return l.tokenValue(fields[name], path+"."+name, types...)
+}
+
+func (l *AstLoader) tokenValue(value any, path string, types ...TokenType) *Token {
+	var lexeme string
+	line, offset := 0.0, 0.0
+	switch value := value.(type) {
+	case string:
+		lexeme = value
+	case map[string]any:
+		lexeme, _ = value["lexeme"].(string)
+		line, _ = value["line"].(float64)
+		offset, _ = value["offset"].(float64)
+	default:
+		l.fail(path, "expect a token")
+		return nil
+	}
+
+	reporter := NewErrorReporter(io.Discard)
+	scanner := NewScanner(lexeme, l.config, reporter)
+	err := scanner.scanTokens()
+	if err != nil || reporter.hadError || len(scanner.Tokens) != 2 || scanner.Tokens[0].Lexeme != lexeme {
+		l.fail(path, "'%v' isn't a single token", lexeme)
+		return nil
+	}
+	token := scanner.Tokens[0]
+	if len(types) > 0 && !slices.Contains(types, token.Type) {
+		l.fail(path, "unexpected token '%v'", lexeme)
+		return nil
+	}
+	token.Line = int(line)
+	token.Offset = int(offset)
+	return token
+}
+
+func (l *AstLoader) stmt(value any, path string) Stmt {
+	nodeType, fields := l.node(value, path)
+	if fields == nil {
+		return nil
+	}
+	switch nodeType {
+	case "StmtBlock":
+		return l.block(value, path)
+	case "StmtClass":
+		var superclass *ExprVariable
+		if fields["superclass"] != nil {
+			superclass, _ = l.expr(fields["superclass"], path+".superclass").(*ExprVariable)
+			if superclass == nil {
+				l.fail(path+".superclass", "expect an ExprVariable")
+			}
+		}
+		name := l.token(fields, "name", path, Identifier)
+		methods := l.functions(fields, "methods", path)
+		staticMethods := l.functions(fields, "staticMethods", path)
+		if !l.config.AllowGettersInClasses {
+			for i, method := range methods {
+				l.requireParams(method, fmt.Sprintf("%v.methods[%d]", path, i))
+			}
+		}
+		for i, method := range staticMethods {
+			l.requireParams(method, fmt.Sprintf("%v.staticMethods[%d]", path, i))
+		}
+		return NewStmtClass(name, superclass, methods, staticMethods).
+			WithKeyword(l.optionalToken(fields, "keyword", path, Class)).WithEnd(l.optionalToken(fields, "end", path, RightBrace))
+	case "StmtExpression":
+		return NewStmtExpression(l.token(fields, "first", path), l.expr(fields["expression"], path+".expression")).
+			WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtFunction":
+		function := l.function(value, path)
+		l.requireParams(function, path)
+		return function
+	case "StmtIf":
+		var elseBranch Stmt
+		if fields["elseBranch"] != nil {
+			elseBranch = l.stmt(fields["elseBranch"], path+".elseBranch")
+		}
+		return NewStmtIf(l.token(fields, "keyword", path), l.expr(fields["condition"], path+".condition"),
+			l.stmt(fields["thenBranch"], path+".thenBranch"), elseBranch)
+	case "StmtPrint":
+		return NewStmtPrint(l.token(fields, "keyword", path), l.expr(fields["expression"], path+".expression")).
+			WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtReturn":
+		return NewStmtReturn(l.token(fields, "keyword", path), l.optionalExpr(fields, "expression", path)).
+			WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtVar":
+		return NewStmtVar(l.token(fields, "name", path, Identifier), l.optionalExpr(fields, "initializer", path)).
+			WithKeyword(l.optionalToken(fields, "keyword", path, Var)).WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtLoop":
+		keyword := l.token(fields, "keyword", path)
+		condition := l.expr(fields["condition"], path+".condition")
+		increment := l.optionalExpr(fields, "increment", path)
+		l.loopDepth++
+		body := l.stmt(fields["body"], path+".body")
+		l.loopDepth--
+		return NewStmtLoop(keyword, condition, increment, body)
+	case "StmtBreak":
+		l.requireLoop("break", path)
+		return NewStmtBreak(l.token(fields, "keyword", path)).WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtContinue":
+		l.requireLoop("continue", path)
+		return NewStmtContinue(l.token(fields, "keyword", path)).WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtAssert":
+		return NewStmtAssert(l.token(fields, "keyword", path), l.expr(fields["condition"], path+".condition"),
+			l.optionalExpr(fields, "message", path)).WithEnd(l.optionalToken(fields, "end", path, Semicolon))
+	case "StmtTest":
+		return NewStmtTest(l.token(fields, "keyword", path), l.token(fields, "name", path, String), l.block(fields["body"], path+".body"))
+	}
+	l.fail(path, "unknown statement '%v'", nodeType)
+	return nil
+}
+
+func (l *AstLoader) block(value any, path string) *StmtBlock {
+	nodeType, fields := l.node(value, path)
+	if fields != nil && nodeType != "StmtBlock" {
+		l.fail(path, "expect a StmtBlock and got %v", nodeType)
+	}
+	return NewStmtBlock(l.token(fields, "brace", path), l.stmts(fields, "statements", path)).
+		WithEnd(l.optionalToken(fields, "end", path, RightBrace))
+}
+
+func (l *AstLoader) function(value any, path string) *StmtFunction {
+	nodeType, fields := l.node(value, path)
+	if fields != nil && nodeType != "StmtFunction" {
+		l.fail(path, "expect a StmtFunction and got %v", nodeType)
+	}
+	var function *ExprFunction
+	functionType, functionFields := l.node(fields["function"], path+".function")
+	if functionFields != nil && functionType != "ExprFunction" {
+		l.fail(path+".function", "expect an ExprFunction and got %v", functionType)
+	}
+	if functionFields != nil {
+		function = l.functionExpr(functionFields, path+".function")
+	}
+	return NewStmtFunction(l.token(fields, "name", path, Identifier), function).WithKeyword(l.optionalToken(fields, "keyword", path, Fun, Class))
+}
+
+// Getters have no parameter list, the loops around the function don't count in its body
+func (l *AstLoader) functionExpr(fields map[string]any, path string) *ExprFunction {
+	loopDepth := l.loopDepth
+	l.loopDepth = 0
+	defer func() {
+		l.loopDepth = loopDepth
+	}()
+	var params []*Token
+	if fields["params"] != nil {
+		params = []*Token{}
+		for i, item := range l.list(fields, "params", path) {
+			params = append(params, l.tokenValue(item, fmt.Sprintf("%v.params[%d]", path, i), Identifier))
+		}
+	}
+	return NewExprFunction(params, l.stmts(fields, "body", path)).
+		WithKeyword(l.optionalToken(fields, "keyword", path, Fun)).WithEnd(l.optionalToken(fields, "end", path, RightBrace))
+}
+
+// The parser only allows getters, the methods without parameter list, in classes and when enabled
+func (l *AstLoader) requireParams(function *StmtFunction, path string) {
+	if function != nil && function.function != nil && function.function.params == nil {
+		l.fail(path+".function", "expect 'params', only methods can be getters")
+	}
+}
+
+// The parser only allows `break` and `continue` in the loops of the function they are in
+func (l *AstLoader) requireLoop(keyword, path string) {
+	if l.loopDepth == 0 {
+		l.fail(path, "'%v' is only valid in 'while' and 'for' loops", keyword)
+	}
+}
+
+func (l *AstLoader) functions(fields map[string]any, name, path string) []*StmtFunction {
+	functions := []*StmtFunction{}
+	for i, item := range l.list(fields, name, path) {
+		functions = append(functions, l.function(item, fmt.Sprintf("%v.%v[%d]", path, name, i)))
+	}
+	return functions
+}
+
+func (l *AstLoader) optionalExpr(fields map[string]any, name, path string) Expr {
+	if fields == nil || fields[name] == nil {
+		return nil
+	}
+	return l.expr(fields[name], path+"."+name)
+}
+
+func (l *AstLoader) expr(value any, path string) Expr {
+	nodeType, fields := l.node(value, path)
+	if fields == nil {
+		return nil
+	}
+	switch nodeType {
+	case "ExprAssign":
+		return NewExprAssign(l.token(fields, "name", path, Identifier), l.expr(fields["value"], path+".value"))
+	case "ExprBinary":
+		return NewExprBinary(l.expr(fields["left"], path+".left"), l.token(fields, "operator", path, binaryOperators...),
+			l.expr(fields["right"], path+".right"))
+	case "ExprFunction":
+		// Anonymous functions are reported at their keyword
+		function := l.functionExpr(fields, path)
+		if function.keyword == nil {
+			l.fail(path, "expect a 'keyword' token")
+		}
+		if function.params == nil {
+			l.fail(path, "expect 'params', only methods can be getters")
+		}
+		return function
+	case "ExprArray":
+		return NewExprArray(l.expr(fields["array"], path+".array"), l.token(fields, "bracket", path), l.expr(fields["index"], path+".index")).
+			WithEnd(l.optionalToken(fields, "end", path, RightBracket))
+	case "ExprArrayInstance":
+		return NewExprArrayInstance(l.exprs(fields, "arguments", path)).
+			WithKeyword(l.optionalToken(fields, "keyword", path)).WithEnd(l.optionalToken(fields, "end", path, RightBrace))
+	case "ExprCall":
+		return NewExprCall(l.expr(fields["callee"], path+".callee"), l.token(fields, "paren", path), l.exprs(fields, "arguments", path))
+	case "ExprGet":
+		return NewExprGet(l.expr(fields["object"], path+".object"), l.token(fields, "name", path, Identifier))
+	case "ExprTernary":
+		return NewExprTernary(l.token(fields, "operator", path, QuestionMark), l.expr(fields["condition"], path+".condition"),
+			l.expr(fields["left"], path+".left"), l.expr(fields["right"], path+".right"))
+	case "ExprGrouping":
+		return NewExprGrouping(l.expr(fields["expression"], path+".expression")).
+			WithParen(l.optionalToken(fields, "paren", path)).WithEnd(l.optionalToken(fields, "end", path, RightParen))
+	case "ExprLiteral":
+		return NewExprLiteral(l.literal(fields["value"], path+".value")).WithToken(l.optionalToken(fields, "token", path))
+	case "ExprLogical":
+		return NewExprLogical(l.expr(fields["left"], path+".left"), l.token(fields, "operator", path, logicalOperators...),
+			l.expr(fields["right"], path+".right"))
+	case "ExprSet":
+		return NewExprSet(l.expr(fields["object"], path+".object"), l.token(fields, "name", path, Identifier),
+			l.expr(fields["value"], path+".value"))
+	case "ExprSetArray":
+		return NewExprSetArray(l.token(fields, "name", path), l.expr(fields["object"], path+".object"),
+			l.expr(fields["index"], path+".index"), l.expr(fields["value"], path+".value"))
+	case "ExprSuper":
+		return NewExprSuper(l.token(fields, "keyword", path, Super), l.token(fields, "method", path, Identifier))
+	case "ExprThis":
+		return NewExprThis(l.token(fields, "keyword", path, This))
+	case "ExprUnary":
+		return NewExprUnary(l.token(fields, "operator", path, unaryOperators...), l.expr(fields["right"], path+".right"))
+	case "ExprVariable":
+		return NewExprVariable(l.token(fields, "name", path, Identifier))
+	}
+	l.fail(path, "unknown expression '%v'", nodeType)
+	return nil
+}
+
+// Strings are bytes for the interpreter
+func (l *AstLoader) literal(value any, path string) any {
+	switch value := value.(type) {
+	case nil, bool, float64:
+		return value
+	case string:
+		return []byte(value)
+	}
+	l.fail(path, "expect a number, a string, a boolean or null")
+	return nil
+}
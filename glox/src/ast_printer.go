@@ -2,87 +2,219 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-type AstPrinter struct{}
+type AstPrinter struct {
+	// Statements don't return a value so they are written here
+	builder strings.Builder
+}
 
 func NewAstPrinter() *AstPrinter {
 	return &AstPrinter{}
 }
 
-// TODO: Update the printer to accept also Statements
 func (ast *AstPrinter) print(expr Expr) any {
 	str, _ := expr.accept(ast)
 	return str
 }
 
+// Every statement is printed on its own line
+func (ast *AstPrinter) printStmts(stmts []Stmt) string {
+	ast.builder.Reset()
+	for i, stmt := range stmts {
+		if i > 0 {
+			ast.builder.WriteByte('\n')
+		}
+		stmt.accept(ast)
+	}
+	return ast.builder.String()
+}
+
+func (ast *AstPrinter) visitBlockStmt(stmt *StmtBlock) error {
+	ast.builder.WriteString("(block")
+	for _, s := range stmt.block {
+		ast.builder.WriteByte(' ')
+		s.accept(ast)
+	}
+	ast.builder.WriteByte(')')
+	return nil
+}
+
+func (ast *AstPrinter) visitClassStmt(stmt *StmtClass) error {
+	ast.builder.WriteString("(class " + stmt.name.Lexeme)
+	if stmt.superclass != nil {
+		ast.builder.WriteString(" < " + stmt.superclass.name.Lexeme)
+	}
+	for _, method := range stmt.methods {
+		ast.builder.WriteByte(' ')
+		method.accept(ast)
+	}
+	for _, staticMethod := range stmt.staticMethods {
+		ast.builder.WriteString(" (class ")
+		staticMethod.accept(ast)
+		ast.builder.WriteByte(')')
+	}
+	ast.builder.WriteByte(')')
+	return nil
+}
+
+func (ast *AstPrinter) visitExpressionStmt(stmt *StmtExpression) error {
+	ast.builder.WriteString(ast.parenthesize(";", stmt.expression))
+	return nil
+}
+
+func (ast *AstPrinter) visitFunctionStmt(stmt *StmtFunction) error {
+	ast.builder.WriteString("(fun " + stmt.name.Lexeme)
+	ast.writeFunction(stmt.function)
+	ast.builder.WriteByte(')')
+	return nil
+}
+
+func (ast *AstPrinter) visitIfStmt(stmt *StmtIf) error {
+	if stmt.elseBranch == nil {
+		ast.builder.WriteString("(if " + ast.exprString(stmt.condition) + " ")
+		stmt.thenBranch.accept(ast)
+	} else {
+		ast.builder.WriteString("(if-else " + ast.exprString(stmt.condition) + " ")
+		stmt.thenBranch.accept(ast)
+		ast.builder.WriteByte(' ')
+		stmt.elseBranch.accept(ast)
+	}
+	ast.builder.WriteByte(')')
+	return nil
+}
+
+func (ast *AstPrinter) visitPrintStmt(stmt *StmtPrint) error {
+	ast.builder.WriteString(ast.parenthesize("print", stmt.expression))
+	return nil
+}
+
+func (ast *AstPrinter) visitReturnStmt(stmt *StmtReturn) error {
+	if stmt.expression == nil {
+		ast.builder.WriteString("(return)")
+		return nil
+	}
+	ast.builder.WriteString(ast.parenthesize("return", stmt.expression))
+	return nil
+}
+
+func (ast *AstPrinter) visitVarStmt(stmt *StmtVar) error {
+	if stmt.initializer == nil {
+		ast.builder.WriteString("(var " + stmt.name.Lexeme + ")")
+		return nil
+	}
+	ast.builder.WriteString(ast.parenthesize("var "+stmt.name.Lexeme+" =", stmt.initializer))
+	return nil
+}
+
+func (ast *AstPrinter) visitLoopStmt(stmt *StmtLoop) error {
+	ast.builder.WriteString("(while " + ast.exprString(stmt.condition) + " ")
+	stmt.body.accept(ast)
+	if stmt.increment != nil {
+		ast.builder.WriteString(" " + ast.exprString(stmt.increment))
+	}
+	ast.builder.WriteByte(')')
+	return nil
+}
+
+func (ast *AstPrinter) visitBreakStmt(stmt *StmtBreak) error {
+	ast.builder.WriteString("(break)")
+	return nil
+}
+
+func (ast *AstPrinter) visitContinueStmt(stmt *StmtContinue) error {
+	ast.builder.WriteString("(continue)")
+	return nil
+}
+
+func (ast *AstPrinter) visitAssertStmt(stmt *StmtAssert) error {
+	if stmt.message == nil {
+		ast.builder.WriteString(ast.parenthesize("assert", stmt.condition))
+		return nil
+	}
+	ast.builder.WriteString(ast.parenthesize("assert", stmt.condition, stmt.message))
+	return nil
+}
+
+func (ast *AstPrinter) visitTestStmt(stmt *StmtTest) error {
+	ast.builder.WriteString("(test " + stmt.name.Lexeme + " ")
+	stmt.body.accept(ast)
+	ast.builder.WriteByte(')')
+	return nil
+}
+
 func (ast *AstPrinter) visitAssignExpr(expr *ExprAssign) (any, error) {
-	return ast.parenthesize("= "+expr.name.Lexeme, expr.value)
+	return ast.parenthesize("= "+expr.name.Lexeme, expr.value), nil
 }
 
 func (ast *AstPrinter) visitBinaryExpr(expr *ExprBinary) (any, error) {
-	return ast.parenthesize(expr.operator.Lexeme, expr.left, expr.right)
+	return ast.parenthesize(expr.operator.Lexeme, expr.left, expr.right), nil
 }
 
 func (ast *AstPrinter) visitFunctionExpr(expr *ExprFunction) (any, error) {
-	panic("not implemented")
+	// The body is made of statements so it's printed on a separate builder
+	printer := NewAstPrinter()
+	printer.builder.WriteString("(fun")
+	printer.writeFunction(expr)
+	printer.builder.WriteByte(')')
+	return printer.builder.String(), nil
 }
 
 func (ast *AstPrinter) visitArrayExpr(expr *ExprArray) (any, error) {
-	return ast.parenthesize("[]", expr.array, expr.index)
+	return ast.parenthesize("[]", expr.array, expr.index), nil
 }
 
 func (ast *AstPrinter) visitCallExpr(expr *ExprCall) (any, error) {
-	astResult, _ := expr.accept(ast)
-	fnName, ok := astResult.(string)
-	if !ok {
-		panic("Unreachable non string return in AstPrinter!")
-	}
-
-	return ast.parenthesize(fnName, expr.arguments...)
+	return ast.parenthesize("call", append([]Expr{expr.callee}, expr.arguments...)...), nil
 }
 
 func (ast *AstPrinter) visitGetExpr(expr *ExprGet) (any, error) {
-	return ast.parenthesize(".", expr)
+	return ast.parenthesize(". "+expr.name.Lexeme, expr.object), nil
 }
 
 func (ast *AstPrinter) visitTernaryExpr(expr *ExprTernary) (any, error) {
-	return ast.parenthesize("?:", expr.condition, expr.left, expr.right)
+	return ast.parenthesize("?:", expr.condition, expr.left, expr.right), nil
 }
 
 func (ast *AstPrinter) visitLogicalExpr(expr *ExprLogical) (any, error) {
-	return ast.parenthesize(expr.operator.Lexeme, expr.left, expr.right)
+	return ast.parenthesize(expr.operator.Lexeme, expr.left, expr.right), nil
 }
 
 func (ast *AstPrinter) visitGroupingExpr(expr *ExprGrouping) (any, error) {
-	return ast.parenthesize("group", expr.expression)
+	return ast.parenthesize("group", expr.expression), nil
 }
 
 func (ast *AstPrinter) visitLiteralExpr(expr *ExprLiteral) (any, error) {
 	if expr.value == nil {
 		return "nil", nil
 	}
-	switch expr.value.(type) {
-	case string:
-		return fmt.Sprintf("\"%v\"", expr.value), nil
+	switch value := expr.value.(type) {
+	case []byte:
+		return fmt.Sprintf("\"%s\"", value), nil
 	case float64:
-		return fmt.Sprintf("%.1f", expr.value), nil
+		// Integers keep a trailing `.0` to tell them apart from identifiers
+		str := strconv.FormatFloat(value, 'f', -1, 64)
+		if !strings.Contains(str, ".") {
+			str += ".0"
+		}
+		return str, nil
 	default:
 		return fmt.Sprintf("%v", expr.value), nil
 	}
 }
 
 func (ast *AstPrinter) visitSetExpr(expr *ExprSet) (any, error) {
-	return ast.parenthesize(expr.name.Lexeme, expr.object, expr.value)
+	return ast.parenthesize("= ."+expr.name.Lexeme, expr.object, expr.value), nil
 }
 
 func (ast *AstPrinter) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
-	return ast.parenthesize("[] =", expr.object, expr.index, expr.value)
+	return ast.parenthesize("[] =", expr.object, expr.index, expr.value), nil
 }
 
 func (ast *AstPrinter) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
-	return ast.parenthesize("[] ", expr.arguments...)
+	return ast.parenthesize("Array", expr.arguments...), nil
 }
 
 func (ast *AstPrinter) visitSuperExpr(expr *ExprSuper) (any, error) {
@@ -94,26 +226,44 @@ func (ast *AstPrinter) visitThisExpr(expr *ExprThis) (any, error) {
 }
 
 func (ast *AstPrinter) visitUnaryExpr(expr *ExprUnary) (any, error) {
-	return ast.parenthesize(expr.operator.Lexeme, expr.right)
+	return ast.parenthesize(expr.operator.Lexeme, expr.right), nil
 }
 
 func (ast *AstPrinter) visitVariableExpr(expr *ExprVariable) (any, error) {
 	return expr.name.Lexeme, nil
 }
 
-func (ast *AstPrinter) parenthesize(name string, exprs ...Expr) (string, error) {
+// Writes `(params) body...` to the statements builder
+func (ast *AstPrinter) writeFunction(function *ExprFunction) {
+	if function.params != nil {
+		params := []string{}
+		for _, param := range function.params {
+			params = append(params, param.Lexeme)
+		}
+		ast.builder.WriteString(" (" + strings.Join(params, " ") + ")")
+	}
+	for _, stmt := range function.body {
+		ast.builder.WriteByte(' ')
+		stmt.accept(ast)
+	}
+}
+
+func (ast *AstPrinter) exprString(expr Expr) string {
+	astResult, _ := expr.accept(ast)
+	if v, ok := astResult.(string); ok {
+		return v
+	}
+	panic("Unreachable non string return in AstPrinter!")
+}
+
+func (ast *AstPrinter) parenthesize(name string, exprs ...Expr) string {
 	var builder strings.Builder
 	builder.WriteByte('(')
 	builder.WriteString(name)
 	for _, expr := range exprs {
 		builder.WriteByte(' ')
-		astResult, _ := expr.accept(ast)
-		if v, ok := astResult.(string); ok {
-			builder.WriteString(v)
-		} else {
-			panic("Unreachable non string return in AstPrinter!")
-		}
+		builder.WriteString(ast.exprString(expr))
 	}
 	builder.WriteByte(')')
-	return builder.String(), nil
+	return builder.String()
 }
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func benchCommand(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox bench [flags] <script>")
+		fmt.Fprintln(os.Stderr, "Runs the `bench_*` functions of the script repeatedly, or the whole script when it has none,")
+		fmt.Fprintln(os.Stderr, "and reports the time, bytes and allocations per run with the noise between the samples")
+		flags.PrintDefaults()
+	}
+	benchtime := flags.Duration("benchtime", time.Second, "run each sample for about `duration`")
+	count := flags.Int("count", 5, "take `n` samples of each benchmark")
+	warmup := flags.Duration("warmup", 200*time.Millisecond, "run each benchmark for `duration` before measuring it")
+	run := flags.String("run", "", "only run the benchmarks whose name matches the `regexp`")
+	output := flags.String("o", "", "save the results to `file` as JSON")
+	compare := flags.String("compare", "", "show the changes from the results saved in `file`")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if *count < 1 {
+		return fmt.Errorf("Expect a --count of at least 1.")
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("Invalid --run pattern: %v.", err)
+	}
+	var baseline *BenchReport
+	if *compare != "" {
+		baseline, err = readBenchReport(*compare)
+		if err != nil {
+			return err
+		}
+	}
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	runner := NewBenchRunner(*benchtime, *count).WithWarmup(*warmup).WithFilter(filter)
+	report, err := runner.runFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if baseline != nil {
+		err = writeBenchComparison(os.Stdout, baseline, report)
+	} else {
+		err = writeBenchText(os.Stdout, report)
+	}
+	if err != nil {
+		return err
+	}
+	return writeReport(*output, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	})
+}
+
+// The results saved by `glox bench -o` and read back by `--compare`
+type BenchReport struct {
+	Script     string         `json:"script"`
+	GoVersion  string         `json:"goVersion"`
+	Date       time.Time      `json:"date"`
+	Benchmarks []*BenchResult `json:"benchmarks"`
+}
+
+type BenchResult struct {
+	Name string `json:"name"`
+	// Runs per sample, chosen so a sample lasts about the bench time
+	Iterations  int       `json:"iterations"`
+	Samples     []float64 `json:"samples"`
+	NsPerOp     float64   `json:"nsPerOp"`
+	Noise       float64   `json:"noise"`
+	BytesPerOp  float64   `json:"bytesPerOp"`
+	AllocsPerOp float64   `json:"allocsPerOp"`
+}
+
+func readBenchReport(path string) (*BenchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &BenchReport{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid benchmark results in '%v': %v.", path, err)
+	}
+	return report, nil
+}
+
+// A benchmark is one run of a `bench_*` function, or of the whole script
+type benchCase struct {
+	name     string
+	function *StmtFunction
+}
+
+func findBenchmarks(stmts []Stmt) []*benchCase {
+	benchmarks := []*benchCase{}
+	for _, stmt := range stmts {
+		if stmt, ok := stmt.(*StmtFunction); ok {
+			if strings.HasPrefix(stmt.name.Lexeme, "bench_") && len(stmt.function.params) == 0 && stmt.function.params != nil {
+				benchmarks = append(benchmarks, &benchCase{name: stmt.name.Lexeme, function: stmt})
+			}
+		}
+	}
+	return benchmarks
+}
+
+// Like the tests, the script is parsed and resolved once and each run shares the resolution.
+// The output of the script is discarded, it would otherwise be measured too
+type BenchRunner struct {
+	benchtime time.Duration
+	count     int
+	warmup    time.Duration
+	filter    *regexp.Regexp
+}
+
+func NewBenchRunner(benchtime time.Duration, count int) *BenchRunner {
+	return &BenchRunner{benchtime: benchtime, count: count}
+}
+
+func (r *BenchRunner) WithWarmup(warmup time.Duration) *BenchRunner {
+	r.warmup = warmup
+	return r
+}
+
+func (r *BenchRunner) WithFilter(filter *regexp.Regexp) *BenchRunner {
+	r.filter = filter
+	return r
+}
+
+func (r *BenchRunner) runFile(filePath string) (*BenchReport, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	compiled := NewInterpreter()
+	stmts, err := compileSource(string(source), compiled, NewErrorReporter(os.Stderr), false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BenchReport{Script: filePath, GoVersion: runtime.Version(), Date: time.Now().UTC()}
+	benchmarks := findBenchmarks(stmts)
+	if len(benchmarks) == 0 {
+		benchmarks = []*benchCase{{name: "script"}}
+	}
+	for _, benchmark := range benchmarks {
+		if r.filter != nil && !r.filter.MatchString(benchmark.name) {
+			continue
+		}
+		op, err := r.prepare(compiled, stmts, benchmark)
+		if err != nil {
+			return nil, err
+		}
+		result, err := r.measure(benchmark.name, op)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", benchmark.name, err)
+		}
+		report.Benchmarks = append(report.Benchmarks, result)
+	}
+	if len(report.Benchmarks) == 0 {
+		return nil, fmt.Errorf("No benchmark matches '%v'.", r.filter)
+	}
+	return report, nil
+}
+
+// The operation measured: a call of the function once the script declared it, or a fresh run of the script
+func (r *BenchRunner) prepare(compiled *Interpreter, stmts []Stmt, benchmark *benchCase) (func() error, error) {
+	newInterpreter := func() *Interpreter {
+		interpreter := NewInterpreter().WithOutput(io.Discard, io.Discard)
+		interpreter.locals = compiled.locals
+		interpreter.config = compiled.config
+		return interpreter
+	}
+	if benchmark.function == nil {
+		return func() error {
+			return newInterpreter().interpret(stmts)
+		}, nil
+	}
+
+	interpreter := newInterpreter()
+	err := interpreter.interpret(stmts)
+	if err != nil {
+		return nil, err
+	}
+	function, err := globalFunction(interpreter, benchmark.function.name.Lexeme)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := function.call(interpreter, []any{})
+		return err
+	}, nil
+}
+
+func (r *BenchRunner) measure(name string, op func() error) (*BenchResult, error) {
+	// Warms up the caches and the allocator, then grows the runs like `go test -bench`
+	// until they last the bench time
+	for start := time.Now(); time.Since(start) < r.warmup; {
+		err := op()
+		if err != nil {
+			return nil, err
+		}
+	}
+	iterations := 1
+	for {
+		elapsed, _, _, err := runBenchSample(op, iterations)
+		if err != nil {
+			return nil, err
+		}
+		if elapsed >= r.benchtime || iterations >= 1e9 {
+			break
+		}
+		perOp := max(elapsed.Nanoseconds()/int64(iterations), 1)
+		next := int(float64(r.benchtime.Nanoseconds()/perOp) * 1.2)
+		iterations = max(min(next, 100*iterations, 1e9), iterations+1)
+	}
+
+	result := &BenchResult{Name: name, Iterations: iterations}
+	var bytes, allocs uint64
+	for i := 0; i < r.count; i++ {
+		elapsed, sampleBytes, sampleAllocs, err := runBenchSample(op, iterations)
+		if err != nil {
+			return nil, err
+		}
+		result.Samples = append(result.Samples, float64(elapsed.Nanoseconds())/float64(iterations))
+		bytes += sampleBytes
+		allocs += sampleAllocs
+	}
+	result.NsPerOp, result.Noise = medianAndNoise(result.Samples)
+	result.BytesPerOp = float64(bytes) / float64(r.count*iterations)
+	result.AllocsPerOp = float64(allocs) / float64(r.count*iterations)
+	return result, nil
+}
+
+func runBenchSample(op func() error, iterations int) (time.Duration, uint64, uint64, error) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		err := op()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return elapsed, after.TotalAlloc - before.TotalAlloc, after.Mallocs - before.Mallocs, nil
+}
+
+// The noise is the largest deviation of a sample from the median, relative to the median
+func medianAndNoise(samples []float64) (float64, float64) {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	if median == 0 {
+		return 0, 0
+	}
+	deviation := math.Max(median-sorted[0], sorted[len(sorted)-1]-median)
+	return median, deviation / median
+}
+
+func writeBenchText(out io.Writer, report *BenchReport) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, result := range report.Benchmarks {
+		fmt.Fprintf(writer, "%v\t%d\t%.0f ns/op\t±%.0f%%\t%.0f B/op\t%.0f allocs/op\t\n",
+			result.Name, result.Iterations, result.NsPerOp, result.Noise*100, result.BytesPerOp, result.AllocsPerOp)
+	}
+	return writer.Flush()
+}
+
+// Changes within the noise of either side are shown as `~`, they tell nothing about the change
+func writeBenchComparison(out io.Writer, baseline, report *BenchReport) error {
+	previous := map[string]*BenchResult{}
+	for _, result := range baseline.Benchmarks {
+		previous[result.Name] = result
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "name\told ns/op\tnew ns/op\tdelta\told B/op\tnew B/op\told allocs/op\tnew allocs/op\t")
+	for _, result := range report.Benchmarks {
+		old, ok := previous[result.Name]
+		if !ok {
+			fmt.Fprintf(writer, "%v\t-\t%.0f ±%.0f%%\tnew\t-\t%.0f\t-\t%.0f\t\n",
+				result.Name, result.NsPerOp, result.Noise*100, result.BytesPerOp, result.AllocsPerOp)
+			continue
+		}
+		fmt.Fprintf(writer, "%v\t%.0f ±%.0f%%\t%.0f ±%.0f%%\t%v\t%.0f\t%.0f\t%.0f\t%.0f\t\n",
+			result.Name, old.NsPerOp, old.Noise*100, result.NsPerOp, result.Noise*100, benchDelta(old, result),
+			old.BytesPerOp, result.BytesPerOp, old.AllocsPerOp, result.AllocsPerOp)
+	}
+	return writer.Flush()
+}
+
+func benchDelta(old, new *BenchResult) string {
+	if old.NsPerOp == 0 {
+		return "~"
+	}
+	delta := (new.NsPerOp - old.NsPerOp) / old.NsPerOp
+	if math.Abs(delta) <= old.Noise+new.Noise {
+		return "~"
+	}
+	return fmt.Sprintf("%+.1f%%", delta*100)
+}
@@ -7,6 +7,10 @@ type Callable interface {
 }
 
 type ProtoCallable struct {
+	// Name of the native function, empty for other callables
+	name string
+	// Reads the outside world, e.g. the clock, so its results can be recorded and replayed
+	isInput      bool
 	arityFunc    func() int
 	callFunc     func(interpreter *Interpreter, arguments []any) (any, error)
 	toStringFunc func() string
@@ -20,11 +24,31 @@ func NewProtoCallable(arity func() int, call func(interpreter *Interpreter, argu
 	}
 }
 
+func (pc *ProtoCallable) WithName(name string) *ProtoCallable {
+	pc.name = name
+	return pc
+}
+
+// Marks a native reading the outside world, its results are recorded and replayed by `--record` and `--replay`
+func (pc *ProtoCallable) WithInput() *ProtoCallable {
+	pc.isInput = true
+	return pc
+}
+
 func (pc *ProtoCallable) arity() int {
 	return pc.arityFunc()
 }
 
 func (pc *ProtoCallable) call(interpreter *Interpreter, arguments []any) (any, error) {
+	if interpreter.profiler != nil && pc.name != "" {
+		interpreter.profiler.enter(pc.name)
+		defer interpreter.profiler.exit()
+	}
+	if pc.isInput && interpreter.inputs != nil {
+		return interpreter.inputs.input(pc.name, func() (any, error) {
+			return pc.callFunc(interpreter, arguments)
+		})
+	}
 	return pc.callFunc(interpreter, arguments)
 }
 
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Config struct {
 	ForbidUnusedVariable        bool
 	ForbidUninitializedVariable bool
@@ -11,6 +16,32 @@ type Config struct {
 	AllowTernaryOperator        bool
 	AllowModuloOperator         bool
 	AllowArrays                 bool
+	AllowAssertStatement        bool
+	AllowTestBlocks             bool
+	// How checks that don't prevent execution, like unused variables, are reported
+	Warnings WarningLevel
+	// Folds the constants and prunes the constant branches before running, see [Optimizer]
+	Optimize bool
+}
+
+type WarningLevel int
+
+const (
+	WarningsAsErrors WarningLevel = iota
+	WarningsShown
+	WarningsIgnored
+)
+
+func ParseWarningLevel(level string) (WarningLevel, error) {
+	switch level {
+	case "error":
+		return WarningsAsErrors, nil
+	case "warning":
+		return WarningsShown, nil
+	case "off":
+		return WarningsIgnored, nil
+	}
+	return WarningsAsErrors, fmt.Errorf("Unknown warning level '%s', expect 'error', 'warning' or 'off'.", level)
 }
 
 var GlobalConfig = ConfigWithExtras
@@ -26,6 +57,65 @@ var ConfigWithExtras = Config{
 	AllowTernaryOperator:        true,
 	AllowModuloOperator:         true,
 	AllowArrays:                 true,
+	AllowAssertStatement:        true,
+	AllowTestBlocks:             true,
 }
 
 var BasicConfig = Config{}
+
+// Named switch of [Config], used to toggle a single feature by name
+type ConfigFeature struct {
+	Name    string
+	aliases []string
+	field   func(config *Config) *bool
+}
+
+var ConfigFeatures = []ConfigFeature{
+	{"UnusedVariable", []string{"unused"}, func(c *Config) *bool { return &c.ForbidUnusedVariable }},
+	{"UninitializedVariable", []string{"uninitialized"}, func(c *Config) *bool { return &c.ForbidUninitializedVariable }},
+	{"ImplicitStringCast", []string{"string-cast"}, func(c *Config) *bool { return &c.AllowImplicitStringCast }},
+	{"StaticMethods", []string{"static"}, func(c *Config) *bool { return &c.AllowStaticMethods }},
+	{"AnonymousFunctions", []string{"anonymous", "lambdas"}, func(c *Config) *bool { return &c.AllowAnonymousFunctions }},
+	{"GettersInClasses", []string{"getters"}, func(c *Config) *bool { return &c.AllowGettersInClasses }},
+	{"ContinueKeyword", []string{"continue"}, func(c *Config) *bool { return &c.AllowContinueKeyword }},
+	{"TernaryOperator", []string{"ternary"}, func(c *Config) *bool { return &c.AllowTernaryOperator }},
+	{"ModuloOperator", []string{"modulo"}, func(c *Config) *bool { return &c.AllowModuloOperator }},
+	{"Arrays", []string{"array"}, func(c *Config) *bool { return &c.AllowArrays }},
+	{"AssertStatement", []string{"assert"}, func(c *Config) *bool { return &c.AllowAssertStatement }},
+	{"TestBlocks", []string{"test", "tests"}, func(c *Config) *bool { return &c.AllowTestBlocks }},
+}
+
+// Names are matched ignoring case, dashes and underscores so `implicit-string-cast` is `ImplicitStringCast`
+func FindConfigFeature(name string) (*ConfigFeature, error) {
+	normalized := normalizeFeatureName(name)
+	for i, feature := range ConfigFeatures {
+		if normalizeFeatureName(feature.Name) == normalized {
+			return &ConfigFeatures[i], nil
+		}
+		for _, alias := range feature.aliases {
+			if normalizeFeatureName(alias) == normalized {
+				return &ConfigFeatures[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Unknown feature '%s'.", name)
+}
+
+func (c *Config) Set(feature string, enabled bool) error {
+	f, err := FindConfigFeature(feature)
+	if err != nil {
+		return err
+	}
+	*f.field(c) = enabled
+	return nil
+}
+
+func (c *Config) IsEnabled(feature *ConfigFeature) bool {
+	return *feature.field(c)
+}
+
+func normalizeFeatureName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.ReplaceAll(name, "-", "")
+	return strings.ReplaceAll(name, "_", "")
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errConformanceFailures = errors.New("conformance failures")
+
+// Annotations of the official test suite, as read by its `tool/bin/test.dart`
+var (
+	expectedOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectedErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	errorLinePattern            = regexp.MustCompile(`// \[((java|c) )?line (\d+)\] (Error.*)`)
+	expectedRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+	syntaxErrorPattern          = regexp.MustCompile(`\[.*line (\d+)\] (Error.+)`)
+	stackTracePattern           = regexp.MustCompile(`\[line (\d+)\]`)
+	nonTestPattern              = regexp.MustCompile(`// nontest`)
+)
+
+// A chapter of the book with the state of the test paths, the longest matching prefix wins
+type ConformanceSuite struct {
+	Name  string
+	tests map[string]bool
+}
+
+func conformanceSuite(name string, groups ...map[string]bool) ConformanceSuite {
+	tests := map[string]bool{}
+	for _, group := range groups {
+		for path, isRun := range group {
+			tests[path] = isRun
+		}
+	}
+	return ConformanceSuite{Name: name, tests: tests}
+}
+
+// Whether the test at [path], relative to the repository, is part of the suite
+func (s ConformanceSuite) includes(path string) bool {
+	isRun, length := false, -1
+	for prefix, state := range s.tests {
+		if strings.HasPrefix(path, prefix) && len(prefix) > length {
+			isRun, length = state, len(prefix)
+		}
+	}
+	return isRun
+}
+
+var (
+	// Benchmarks only time the implementation and the first chapters need tools glox doesn't have
+	conformanceDefaults = map[string]bool{
+		"test":             true,
+		"test/benchmark":   false,
+		"test/scanning":    false,
+		"test/expressions": false,
+	}
+	// Limits of clox, the Go stack is relied upon for overflows
+	conformanceNoLimits = map[string]bool{
+		"test/limit/loop_too_large.lox":     false,
+		"test/limit/no_reuse_constants.lox": false,
+		"test/limit/too_many_constants.lox": false,
+		"test/limit/too_many_locals.lox":    false,
+		"test/limit/too_many_upvalues.lox":  false,
+		"test/limit/stack_overflow.lox":     false,
+		// Kept out like for jlox, whose boxed doubles don't follow IEEE equality
+		"test/number/nan_equality.lox": false,
+	}
+	conformanceNoClasses = map[string]bool{
+		"test/assignment/to_this.lox":                  false,
+		"test/call/object.lox":                         false,
+		"test/class":                                   false,
+		"test/closure/close_over_method_parameter.lox": false,
+		"test/constructor":                             false,
+		"test/field":                                   false,
+		"test/inheritance":                             false,
+		"test/method":                                  false,
+		"test/number/decimal_point_at_eof.lox":         false,
+		"test/number/trailing_dot.lox":                 false,
+		"test/operator/equals_class.lox":               false,
+		"test/operator/equals_method.lox":              false,
+		"test/operator/not_class.lox":                  false,
+		"test/regression/394.lox":                      false,
+		"test/super":                                   false,
+		"test/this":                                    false,
+		"test/return/in_method.lox":                    false,
+		"test/variable/local_from_method.lox":          false,
+	}
+	conformanceNoFunctions = map[string]bool{
+		"test/call":                      false,
+		"test/closure":                   false,
+		"test/for/closure_in_body.lox":   false,
+		"test/for/return_closure.lox":    false,
+		"test/for/return_inside.lox":     false,
+		"test/for/syntax.lox":            false,
+		"test/function":                  false,
+		"test/operator/not.lox":          false,
+		"test/regression/40.lox":         false,
+		"test/return":                    false,
+		"test/unexpected_character.lox":  false,
+		"test/while/closure_in_body.lox": false,
+		"test/while/return_closure.lox":  false,
+		"test/while/return_inside.lox":   false,
+	}
+	conformanceNoResolution = map[string]bool{
+		"test/closure/assign_to_shadowed_later.lox":  false,
+		"test/function/local_mutual_recursion.lox":   false,
+		"test/variable/collide_with_parameter.lox":   false,
+		"test/variable/duplicate_local.lox":          false,
+		"test/variable/duplicate_parameter.lox":      false,
+		"test/variable/early_bound.lox":              false,
+		"test/return/at_top_level.lox":               false,
+		"test/variable/use_local_in_initializer.lox": false,
+	}
+)
+
+// The jlox chapters of the book, `jlox` being the complete interpreter
+var ConformanceSuites = []ConformanceSuite{
+	conformanceSuite("jlox", conformanceDefaults, conformanceNoLimits),
+	conformanceSuite(
+		"chap08_statements",
+		conformanceDefaults,
+		conformanceNoLimits,
+		conformanceNoFunctions,
+		conformanceNoResolution,
+		conformanceNoClasses,
+		map[string]bool{
+			"test/block/empty.lox":                  false,
+			"test/for":                              false,
+			"test/if":                               false,
+			"test/logical_operator":                 false,
+			"test/while":                            false,
+			"test/variable/unreached_undefined.lox": false,
+		},
+	),
+	conformanceSuite(
+		"chap09_control",
+		conformanceDefaults,
+		conformanceNoLimits,
+		conformanceNoFunctions,
+		conformanceNoResolution,
+		conformanceNoClasses,
+	),
+	conformanceSuite("chap10_functions", conformanceDefaults, conformanceNoLimits, conformanceNoResolution, conformanceNoClasses),
+	conformanceSuite("chap11_resolving", conformanceDefaults, conformanceNoLimits, conformanceNoClasses),
+	conformanceSuite(
+		"chap12_classes",
+		conformanceDefaults,
+		conformanceNoLimits,
+		map[string]bool{"test/inheritance": false, "test/super": false},
+	),
+	conformanceSuite("chap13_inheritance", conformanceDefaults, conformanceNoLimits),
+}
+
+// Finds a suite by name, `10` and `chap10` being short for `chap10_functions`
+func findConformanceSuite(name string) (ConformanceSuite, error) {
+	names := []string{}
+	for _, suite := range ConformanceSuites {
+		number, _, _ := strings.Cut(strings.TrimPrefix(suite.Name, "chap"), "_")
+		if suite.Name == name || "chap"+number == name || number == name {
+			return suite, nil
+		}
+		names = append(names, suite.Name)
+	}
+	return ConformanceSuite{}, fmt.Errorf("Unknown chapter '%v', expect one of %v.", name, strings.Join(names, ", "))
+}
+
+func conformanceCommand(args []string) error {
+	flags := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox conformance [flags] <dir>")
+		fmt.Fprintln(os.Stderr, "Runs the test suite of the Crafting Interpreters repository, or of its `test` directory, with extras disabled")
+		flags.PrintDefaults()
+	}
+	chapter := flags.String("chapter", "jlox", "run the tests of the `chapter`, e.g. chap10_functions or 10")
+	jobs := flags.Int("j", runtime.NumCPU(), "run `n` tests in parallel")
+	timeout := flags.Duration("timeout", 10*time.Second, "interrupt a test running longer than `duration`")
+	verbose := flags.Bool("v", false, "list the tests passing too")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *jobs < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	suite, err := findConformanceSuite(*chapter)
+	if err != nil {
+		return err
+	}
+
+	// The suite expects the book's behaviour, the features can still be enabled back one by one
+	*disableExtras = true
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tests, skipped, err := conformanceTests(flags.Arg(0), suite)
+	if err != nil {
+		return err
+	}
+	results := runConformanceTests(tests, *jobs, *timeout)
+
+	failed := 0
+	for _, result := range results {
+		if len(result.failures) == 0 {
+			if *verbose {
+				fmt.Printf("PASS %v\n", result.test.Path)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %v\n", result.test.Path)
+		for _, failure := range result.failures {
+			fmt.Printf("     %v\n", failure)
+		}
+	}
+	fmt.Printf("%v: %d passed, %d failed, %d skipped.\n", suite.Name, len(results)-failed, failed, skipped)
+	if failed > 0 {
+		return errConformanceFailures
+	}
+	return nil
+}
+
+// A test file of the suite with the expectations read from its comments
+type ConformanceTest struct {
+	// Relative to the repository, e.g. `test/for/syntax.lox`
+	Path           string
+	source         string
+	output         []conformanceOutput
+	errors         []string
+	runtimeError   string
+	runtimeLine    int
+	expectedStatus int
+}
+
+type conformanceOutput struct {
+	line int
+	text string
+}
+
+type conformanceResult struct {
+	test     *ConformanceTest
+	failures []string
+}
+
+// Lists the tests of [suite] in [dir], the repository or its `test` directory, with the number skipped
+func conformanceTests(dir string, suite ConformanceSuite) ([]*ConformanceTest, int, error) {
+	root := dir
+	if info, err := os.Stat(filepath.Join(dir, "test")); err == nil && info.IsDir() {
+		root = filepath.Join(dir, "test")
+	}
+	tests := []*ConformanceTest{}
+	skipped := 0
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(file) != ".lox" {
+			return err
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		path := "test/" + filepath.ToSlash(relative)
+		if !suite.includes(path) {
+			skipped++
+			return nil
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		test := parseConformanceTest(path, string(source))
+		if test == nil {
+			skipped++
+			return nil
+		}
+		tests = append(tests, test)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(tests) == 0 {
+		return nil, 0, fmt.Errorf("No test of %v found in '%v'.", suite.Name, dir)
+	}
+	return tests, skipped, nil
+}
+
+// Reads the expectations of a test, `nil` for files marked `nontest`
+func parseConformanceTest(path, source string) *ConformanceTest {
+	test := &ConformanceTest{Path: path, source: source}
+	for i, line := range strings.Split(source, "\n") {
+		number := i + 1
+		if nonTestPattern.MatchString(line) {
+			return nil
+		}
+		if match := expectedOutputPattern.FindStringSubmatch(line); match != nil {
+			test.output = append(test.output, conformanceOutput{number, match[1]})
+			continue
+		}
+		if match := expectedErrorPattern.FindStringSubmatch(line); match != nil {
+			test.errors = append(test.errors, fmt.Sprintf("[%d] %v", number, match[1]))
+			test.expectedStatus = exDataErr
+			continue
+		}
+		if match := errorLinePattern.FindStringSubmatch(line); match != nil {
+			// Errors specific to clox are reported differently by a tree-walk interpreter
+			if match[2] == "" || match[2] == "java" {
+				test.errors = append(test.errors, fmt.Sprintf("[%v] %v", match[3], match[4]))
+				test.expectedStatus = exDataErr
+			}
+			continue
+		}
+		if match := expectedRuntimeErrorPattern.FindStringSubmatch(line); match != nil {
+			test.runtimeLine = number
+			test.runtimeError = match[1]
+			test.expectedStatus = exRuntimeErr
+		}
+	}
+	return test
+}
+
+// Runs the tests on [jobs] goroutines, the results keep the order of the paths
+func runConformanceTests(tests []*ConformanceTest, jobs int, timeout time.Duration) []conformanceResult {
+	slices.SortFunc(tests, func(a, b *ConformanceTest) int { return strings.Compare(a.Path, b.Path) })
+	results := make([]conformanceResult, len(tests))
+	indexes := make(chan int)
+	var group sync.WaitGroup
+	for range min(jobs, len(tests)) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for i := range indexes {
+				results[i] = conformanceResult{tests[i], tests[i].run(timeout)}
+			}
+		}()
+	}
+	for i := range tests {
+		indexes <- i
+	}
+	close(indexes)
+	group.Wait()
+	return results
+}
+
+// Runs the test in a fresh interpreter and returns what doesn't match the expectations
+func (t *ConformanceTest) run(timeout time.Duration) (failures []string) {
+	var stdout, stderr bytes.Buffer
+	interpreter := NewInterpreter().WithOutput(&stdout, &stderr)
+	timer := time.AfterFunc(timeout, interpreter.Interrupt)
+	defer timer.Stop()
+	defer func() {
+		if r := recover(); r != nil {
+			failures = []string{fmt.Sprintf("Interpreter panic: %v", r)}
+		}
+	}()
+
+	status := 0
+	err := run(t.source, interpreter, false)
+	if interpreter.IsInterrupted() {
+		return []string{fmt.Sprintf("Timed out after %v.", timeout)}
+	}
+	if err != nil {
+		status = exitCode(err)
+	}
+	errorLines := conformanceLines(stderr.String())
+	if t.runtimeError != "" {
+		failures = append(failures, t.checkRuntimeError(errorLines)...)
+	} else {
+		failures = append(failures, t.checkCompileErrors(errorLines)...)
+	}
+	if status != t.expectedStatus {
+		failures = append(failures, fmt.Sprintf("Expected return code %d and got %d.", t.expectedStatus, status))
+	}
+	return append(failures, t.checkOutput(conformanceLines(stdout.String()))...)
+}
+
+func (t *ConformanceTest) checkRuntimeError(errorLines []string) []string {
+	if len(errorLines) < 2 {
+		return []string{fmt.Sprintf("Expected runtime error '%v' and got none.", t.runtimeError)}
+	}
+	if errorLines[0] != t.runtimeError {
+		return []string{fmt.Sprintf("Expected runtime error '%v' and got '%v'.", t.runtimeError, errorLines[0])}
+	}
+	for _, line := range errorLines[1:] {
+		match := stackTracePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if line, _ := strconv.Atoi(match[1]); line != t.runtimeLine {
+			return []string{fmt.Sprintf("Expected runtime error on line %d but was on line %d.", t.runtimeLine, line)}
+		}
+		return nil
+	}
+	return []string{fmt.Sprintf("Expected stack trace and got '%v'.", strings.Join(errorLines[1:], " "))}
+}
+
+func (t *ConformanceTest) checkCompileErrors(errorLines []string) []string {
+	failures := []string{}
+	found := map[string]bool{}
+	for _, line := range errorLines {
+		match := syntaxErrorPattern.FindStringSubmatch(line)
+		switch {
+		case match != nil && slices.Contains(t.errors, fmt.Sprintf("[%v] %v", match[1], match[2])):
+			found[fmt.Sprintf("[%v] %v", match[1], match[2])] = true
+		case match != nil:
+			failures = append(failures, fmt.Sprintf("Unexpected error: %v", line))
+		case line != "":
+			failures = append(failures, fmt.Sprintf("Unexpected output on stderr: %v", line))
+		}
+	}
+	for _, expected := range t.errors {
+		if !found[expected] {
+			failures = append(failures, fmt.Sprintf("Missing expected error: %v", expected))
+		}
+	}
+	return failures
+}
+
+func (t *ConformanceTest) checkOutput(lines []string) []string {
+	failures := []string{}
+	for i, line := range lines {
+		if i >= len(t.output) {
+			failures = append(failures, fmt.Sprintf("Got output '%v' when none was expected.", line))
+			continue
+		}
+		if expected := t.output[i]; expected.text != line {
+			failures = append(failures, fmt.Sprintf("Expected output '%v' on line %d and got '%v'.", expected.text, expected.line, line))
+		}
+	}
+	for _, expected := range t.output[min(len(lines), len(t.output)):] {
+		failures = append(failures, fmt.Sprintf("Missing expected output '%v' on line %d.", expected.text, expected.line))
+	}
+	return failures
+}
+
+// Lines of an output without the empty one after its last newline
+func conformanceLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Counts the statements executed and the branches taken of the registered scripts
+type Coverage struct {
+	files      []*CoverageFile
+	statements map[Stmt]*coverageStatement
+	// By `if` statement, ternary or logical expression
+	branches map[any]*coverageBranch
+}
+
+type CoverageFile struct {
+	Path       string
+	lines      []string
+	statements []*coverageStatement
+	branches   []*coverageBranch
+}
+
+type coverageStatement struct {
+	token *Token
+	hits  int
+}
+
+// Branch 0 is the `then` side of an `if` or ternary and the evaluation of the right operand of
+// `and` and `or`, branch 1 the `else` side or the short-circuit
+type coverageBranch struct {
+	token *Token
+	// `false` until the condition is evaluated once
+	isReached bool
+	taken     [2]int
+}
+
+func (b *coverageBranch) labels() [2]string {
+	switch b.token.Type {
+	case If:
+		return [2]string{"then", "else"}
+	case And, Or:
+		return [2]string{"right operand", "short-circuit"}
+	}
+	return [2]string{"true", "false"}
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		statements: map[Stmt]*coverageStatement{},
+		branches:   map[any]*coverageBranch{},
+	}
+}
+
+// Registers the statements and branches of a script before it runs, so the ones never reached are reported
+func (c *Coverage) register(path, source string, stmts []Stmt) {
+	file := &CoverageFile{Path: path, lines: strings.Split(source, "\n")}
+	collector := &coverageCollector{coverage: c, file: file}
+	collector.stmts(stmts)
+	slices.SortStableFunc(file.statements, func(a, b *coverageStatement) int {
+		return cmp.Compare(a.token.Offset, b.token.Offset)
+	})
+	slices.SortStableFunc(file.branches, func(a, b *coverageBranch) int {
+		return cmp.Compare(a.token.Offset, b.token.Offset)
+	})
+	c.files = append(c.files, file)
+}
+
+func (c *Coverage) hitStatement(stmt Stmt) {
+	if statement, ok := c.statements[stmt]; ok {
+		statement.hits++
+	}
+}
+
+// Index of the branch taken, see [coverageBranch]
+func branchIndex(isFirst bool) int {
+	if isFirst {
+		return 0
+	}
+	return 1
+}
+
+func (c *Coverage) hitBranch(node any, branch int) {
+	if coverageBranch, ok := c.branches[node]; ok {
+		coverageBranch.isReached = true
+		coverageBranch.taken[branch]++
+	}
+}
+
+// Lines starting a statement with the most hits of those statements, by line number
+func (f *CoverageFile) lineHits() map[int]int {
+	hits := map[int]int{}
+	for _, statement := range f.statements {
+		hits[statement.token.Line] = max(hits[statement.token.Line], statement.hits)
+	}
+	return hits
+}
+
+func (f *CoverageFile) branchesByLine() map[int][]*coverageBranch {
+	branches := map[int][]*coverageBranch{}
+	for _, branch := range f.branches {
+		branches[branch.token.Line] = append(branches[branch.token.Line], branch)
+	}
+	return branches
+}
+
+// Found and hit lines, then found and taken branches
+func (f *CoverageFile) summary() (lines, linesHit, branches, branchesTaken int) {
+	for _, hits := range f.lineHits() {
+		lines++
+		if hits > 0 {
+			linesHit++
+		}
+	}
+	for _, branch := range f.branches {
+		for _, taken := range branch.taken {
+			branches++
+			if taken > 0 {
+				branchesTaken++
+			}
+		}
+	}
+	return
+}
+
+// Writes the LCOV tracefile read by `genhtml` and most CI coverage services
+func (c *Coverage) writeLcov(out io.Writer) error {
+	var builder strings.Builder
+	for _, file := range c.files {
+		fmt.Fprintf(&builder, "TN:\nSF:%v\n", file.Path)
+		for block, branch := range file.branches {
+			for i, taken := range branch.taken {
+				count := "-"
+				if branch.isReached {
+					count = fmt.Sprint(taken)
+				}
+				fmt.Fprintf(&builder, "BRDA:%d,%d,%d,%v\n", branch.token.Line, block, i, count)
+			}
+		}
+		lines, linesHit, branches, branchesTaken := file.summary()
+		fmt.Fprintf(&builder, "BRF:%d\nBRH:%d\n", branches, branchesTaken)
+		hits := file.lineHits()
+		for _, line := range sortedKeys(hits) {
+			fmt.Fprintf(&builder, "DA:%d,%d\n", line, hits[line])
+		}
+		fmt.Fprintf(&builder, "LF:%d\nLH:%d\nend_of_record\n", lines, linesHit)
+	}
+	_, err := io.WriteString(out, builder.String())
+	return err
+}
+
+const coverageStyle = `body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0 0.6em; text-align: left; }
+.source td { font-family: monospace; white-space: pre; }
+.source td.number, .source td.hits { color: #777; text-align: right; }
+tr.hit td.code { background: #dfd; }
+tr.missed td.code { background: #fdd; }
+tr.partial td.code { background: #ffd; }`
+
+// Writes a single page with the summary of each script and its source annotated with the hit counts
+func (c *Coverage) writeHTML(out io.Writer) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Lox coverage</title>\n<style>\n%v\n</style>\n</head>\n<body>\n", coverageStyle)
+	builder.WriteString("<h1>Lox coverage</h1>\n<table>\n<tr><th>Script</th><th>Lines</th><th>Branches</th></tr>\n")
+	for i, file := range c.files {
+		lines, linesHit, branches, branchesTaken := file.summary()
+		fmt.Fprintf(
+			&builder,
+			"<tr><td><a href=\"#file-%d\">%v</a></td><td>%v</td><td>%v</td></tr>\n",
+			i,
+			html.EscapeString(file.Path),
+			ratio(linesHit, lines),
+			ratio(branchesTaken, branches),
+		)
+	}
+	builder.WriteString("</table>\n")
+
+	for i, file := range c.files {
+		fmt.Fprintf(&builder, "<h2 id=\"file-%d\">%v</h2>\n<table class=\"source\">\n", i, html.EscapeString(file.Path))
+		hits := file.lineHits()
+		branches := file.branchesByLine()
+		for index, text := range file.lines {
+			line := index + 1
+			class, count, title := "", "", ""
+			if lineHits, ok := hits[line]; ok {
+				class = "hit"
+				if lineHits == 0 {
+					class = "missed"
+				}
+				count = fmt.Sprintf("%d×", lineHits)
+			}
+			if lineBranches, ok := branches[line]; ok {
+				descriptions := []string{}
+				for _, branch := range lineBranches {
+					if class == "hit" && (branch.taken[0] == 0 || branch.taken[1] == 0) {
+						class = "partial"
+					}
+					labels := branch.labels()
+					descriptions = append(descriptions, fmt.Sprintf(
+						"'%v': %v %d×, %v %d×", branch.token.Lexeme, labels[0], branch.taken[0], labels[1], branch.taken[1],
+					))
+				}
+				title = fmt.Sprintf(" title=\"%v\"", html.EscapeString(strings.Join(descriptions, ", ")))
+			}
+			fmt.Fprintf(
+				&builder,
+				"<tr class=\"%v\"%v><td class=\"number\">%d</td><td class=\"hits\">%v</td><td class=\"code\">%v</td></tr>\n",
+				class,
+				title,
+				line,
+				count,
+				html.EscapeString(strings.TrimRight(text, "\r")),
+			)
+		}
+		builder.WriteString("</table>\n")
+	}
+	builder.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(out, builder.String())
+	return err
+}
+
+func ratio(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", part, total, float64(part)/float64(total)*100)
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := []int{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Finds the statements and branch points of a script, blocks only count through their statements
+type coverageCollector struct {
+	coverage *Coverage
+	file     *CoverageFile
+}
+
+func (c *coverageCollector) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*StmtBlock); !ok {
+			statement := &coverageStatement{token: stmt.firstToken()}
+			c.coverage.statements[stmt] = statement
+			c.file.statements = append(c.file.statements, statement)
+		}
+		stmt.accept(c)
+	}
+}
+
+func (c *coverageCollector) expr(expr Expr) {
+	if expr != nil {
+		expr.accept(c)
+	}
+}
+
+func (c *coverageCollector) branch(node any, token *Token) {
+	branch := &coverageBranch{token: token}
+	c.coverage.branches[node] = branch
+	c.file.branches = append(c.file.branches, branch)
+}
+
+func (c *coverageCollector) visitBlockStmt(stmt *StmtBlock) error {
+	c.stmts(stmt.block)
+	return nil
+}
+
+func (c *coverageCollector) visitClassStmt(stmt *StmtClass) error {
+	for _, method := range slices.Concat(stmt.methods, stmt.staticMethods) {
+		c.stmts(method.function.body)
+	}
+	return nil
+}
+
+func (c *coverageCollector) visitFunctionStmt(stmt *StmtFunction) error {
+	c.stmts(stmt.function.body)
+	return nil
+}
+
+func (c *coverageCollector) visitIfStmt(stmt *StmtIf) error {
+	c.branch(stmt, stmt.keyword)
+	c.expr(stmt.condition)
+	c.stmts([]Stmt{stmt.thenBranch})
+	if stmt.elseBranch != nil {
+		c.stmts([]Stmt{stmt.elseBranch})
+	}
+	return nil
+}
+
+func (c *coverageCollector) visitLoopStmt(stmt *StmtLoop) error {
+	c.expr(stmt.condition)
+	c.expr(stmt.increment)
+	c.stmts([]Stmt{stmt.body})
+	return nil
+}
+
+func (c *coverageCollector) visitExpressionStmt(stmt *StmtExpression) error {
+	c.expr(stmt.expression)
+	return nil
+}
+
+func (c *coverageCollector) visitPrintStmt(stmt *StmtPrint) error {
+	c.expr(stmt.expression)
+	return nil
+}
+
+func (c *coverageCollector) visitReturnStmt(stmt *StmtReturn) error {
+	c.expr(stmt.expression)
+	return nil
+}
+
+func (c *coverageCollector) visitVarStmt(stmt *StmtVar) error {
+	c.expr(stmt.initializer)
+	return nil
+}
+
+func (c *coverageCollector) visitBreakStmt(stmt *StmtBreak) error {
+	return nil
+}
+
+func (c *coverageCollector) visitContinueStmt(stmt *StmtContinue) error {
+	return nil
+}
+
+func (c *coverageCollector) visitAssertStmt(stmt *StmtAssert) error {
+	c.expr(stmt.condition)
+	c.expr(stmt.message)
+	return nil
+}
+
+func (c *coverageCollector) visitTestStmt(stmt *StmtTest) error {
+	c.stmts(stmt.body.block)
+	return nil
+}
+
+func (c *coverageCollector) visitAssignExpr(expr *ExprAssign) (any, error) {
+	c.expr(expr.value)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitBinaryExpr(expr *ExprBinary) (any, error) {
+	c.expr(expr.left)
+	c.expr(expr.right)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitFunctionExpr(expr *ExprFunction) (any, error) {
+	c.stmts(expr.body)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitArrayExpr(expr *ExprArray) (any, error) {
+	c.expr(expr.array)
+	c.expr(expr.index)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
+	for _, argument := range expr.arguments {
+		c.expr(argument)
+	}
+	return nil, nil
+}
+
+func (c *coverageCollector) visitCallExpr(expr *ExprCall) (any, error) {
+	c.expr(expr.callee)
+	for _, argument := range expr.arguments {
+		c.expr(argument)
+	}
+	return nil, nil
+}
+
+func (c *coverageCollector) visitGetExpr(expr *ExprGet) (any, error) {
+	c.expr(expr.object)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitTernaryExpr(expr *ExprTernary) (any, error) {
+	c.branch(expr, expr.operator)
+	c.expr(expr.condition)
+	c.expr(expr.left)
+	c.expr(expr.right)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitGroupingExpr(expr *ExprGrouping) (any, error) {
+	c.expr(expr.expression)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	return nil, nil
+}
+
+func (c *coverageCollector) visitLogicalExpr(expr *ExprLogical) (any, error) {
+	c.branch(expr, expr.operator)
+	c.expr(expr.left)
+	c.expr(expr.right)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitSetExpr(expr *ExprSet) (any, error) {
+	c.expr(expr.object)
+	c.expr(expr.value)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
+	c.expr(expr.object)
+	c.expr(expr.index)
+	c.expr(expr.value)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitSuperExpr(expr *ExprSuper) (any, error) {
+	return nil, nil
+}
+
+func (c *coverageCollector) visitThisExpr(expr *ExprThis) (any, error) {
+	return nil, nil
+}
+
+func (c *coverageCollector) visitUnaryExpr(expr *ExprUnary) (any, error) {
+	c.expr(expr.right)
+	return nil, nil
+}
+
+func (c *coverageCollector) visitVariableExpr(expr *ExprVariable) (any, error) {
+	return nil, nil
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The interpreter runs a single thread
+const dapThreadID = 1
+
+// Debug adapter speaking the Debug Adapter Protocol over stdio
+// Requests are served on the reading goroutine while the script runs on its own one,
+// the script only blocks in [DapServer.pause] so its state can be inspected meanwhile
+type DapServer struct {
+	reader *bufio.Reader
+	// Guards the writes, the seq counter and the state shared with the script goroutine
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+
+	program     string
+	interpreter *Interpreter
+	debugger    *Debugger
+	stmts       []Stmt
+	isStarted   bool
+	isPaused    bool
+	// Receives how to go on while the script is paused
+	resume chan dapResume
+	// Variables references handed out during the current pause, the reference is the index plus one
+	handles []any
+}
+
+type dapResume struct {
+	mode   StepMode
+	isQuit bool
+}
+
+// Handle of the global variables in [DapServer.handles]
+type dapGlobals struct{}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+func NewDapServer(in io.Reader, out io.Writer) *DapServer {
+	return &DapServer{
+		reader: bufio.NewReader(in),
+		out:    out,
+		resume: make(chan dapResume),
+	}
+}
+
+func dapCommand(args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox dap [flags]")
+		fmt.Fprintln(os.Stderr, "Serves the Debug Adapter Protocol over the standard input and output")
+		flags.PrintDefaults()
+	}
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	return NewDapServer(os.Stdin, os.Stdout).serve()
+}
+
+func (s *DapServer) serve() error {
+	for {
+		body, err := readFramed(s.reader)
+		if errors.Is(err, io.EOF) {
+			s.stop()
+			return nil
+		} else if err != nil {
+			return err
+		}
+		request := &dapRequest{}
+		if json.Unmarshal(body, request) != nil || request.Type != "request" {
+			continue
+		}
+
+		result, err := s.handle(request)
+		response := &dapResponse{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: err == nil}
+		if err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Body = result
+		}
+		s.send(response)
+
+		switch request.Command {
+		case "initialize":
+			// Breakpoints are set after this, until `configurationDone` starts the script
+			s.event("initialized", nil)
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *DapServer) send(message any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch message := message.(type) {
+	case *dapResponse:
+		message.Seq = s.seq
+	case *dapEvent:
+		message.Seq = s.seq
+	}
+	err := writeFramed(s.out, message)
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Can't encode the DAP message: %v\n", err)
+	// The client still gets a response to its request
+	if response, ok := message.(*dapResponse); ok && response.Success {
+		s.seq++
+		writeFramed(s.out, &dapResponse{Seq: s.seq, Type: "response", RequestSeq: response.RequestSeq, Command: response.Command,
+			Message: fmt.Sprintf("Can't encode the response: %v.", err)})
+	}
+}
+
+func (s *DapServer) event(name string, body any) {
+	s.send(&dapEvent{Type: "event", Event: name, Body: body})
+}
+
+func (s *DapServer) handle(request *dapRequest) (any, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var arguments struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(arguments.Program, arguments.StopOnEntry)
+	case "setBreakpoints":
+		var arguments struct {
+			Source      dapSource `json:"source"`
+			Breakpoints []struct {
+				Line      int    `json:"line"`
+				Condition string `json:"condition"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		if s.debugger == nil {
+			return nil, fmt.Errorf("Can't set breakpoints before launching.")
+		}
+		isProgram := sameFile(arguments.Source.Path, s.program)
+		if isProgram {
+			s.debugger.ClearBreakpoints()
+		}
+		breakpoints := []map[string]any{}
+		for _, requested := range arguments.Breakpoints {
+			breakpoint := map[string]any{"line": requested.Line, "verified": false}
+			if !isProgram {
+				breakpoint["message"] = "Only the launched program can have breakpoints."
+			} else if _, err := s.debugger.SetBreakpoint(requested.Line, requested.Condition); err != nil {
+				breakpoint["message"] = err.Error()
+			} else {
+				breakpoint["verified"] = true
+			}
+			breakpoints = append(breakpoints, breakpoint)
+		}
+		return map[string]any{"breakpoints": breakpoints}, nil
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []any{}}, nil
+	case "configurationDone":
+		return nil, s.start()
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": dapThreadID, "name": "main"}}}, nil
+	case "stackTrace":
+		return s.whilePaused(func() (any, error) {
+			frames := []map[string]any{}
+			source := dapSource{Name: filepath.Base(s.program), Path: s.program}
+			for i, frame := range s.debugger.Frames() {
+				frames = append(frames, map[string]any{
+					"id":     i + 1,
+					"name":   frame.Name,
+					"line":   frame.Line(),
+					"column": 1,
+					"source": source,
+				})
+			}
+			return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+		})
+	case "scopes":
+		var arguments struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.whilePaused(func() (any, error) {
+			frames := s.debugger.Frames()
+			if arguments.FrameID < 1 || arguments.FrameID > len(frames) {
+				return nil, fmt.Errorf("No frame %d.", arguments.FrameID)
+			}
+			scopes := []map[string]any{}
+			env := frames[arguments.FrameID-1].Environment
+			// The environment of the script itself is empty, its variables are the globals
+			if env.enclosing != nil {
+				scopes = append(scopes, map[string]any{"name": "Locals", "variablesReference": s.reference(env), "expensive": false})
+			}
+			scopes = append(scopes, map[string]any{"name": "Globals", "variablesReference": s.reference(dapGlobals{}), "expensive": false})
+			return map[string]any{"scopes": scopes}, nil
+		})
+	case "variables":
+		var arguments struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.whilePaused(func() (any, error) {
+			if arguments.VariablesReference < 1 || arguments.VariablesReference > len(s.handles) {
+				return nil, fmt.Errorf("Unknown variables reference %d.", arguments.VariablesReference)
+			}
+			return map[string]any{"variables": s.variables(s.handles[arguments.VariablesReference-1])}, nil
+		})
+	case "evaluate":
+		var arguments struct {
+			Expression string `json:"expression"`
+			FrameID    int    `json:"frameId"`
+		}
+		if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.whilePaused(func() (any, error) {
+			frame := max(arguments.FrameID-1, 0)
+			value, err := s.debugger.Evaluate(arguments.Expression, frame)
+			if err != nil {
+				return nil, err
+			}
+			variable := s.variable("", value)
+			return map[string]any{"result": variable.Value, "type": variable.Type, "variablesReference": variable.VariablesReference}, nil
+		})
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.continueWith(StepContinue)
+	case "next":
+		return nil, s.continueWith(StepOver)
+	case "stepIn":
+		return nil, s.continueWith(StepIn)
+	case "stepOut":
+		return nil, s.continueWith(StepOut)
+	case "pause":
+		if s.debugger == nil {
+			return nil, fmt.Errorf("No program is running.")
+		}
+		s.debugger.RequestPause()
+		return nil, nil
+	case "disconnect", "terminate":
+		s.stop()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Request '%v' not supported.", request.Command)
+}
+
+// Prepares the program, it only starts running once the configuration is done
+func (s *DapServer) launch(program string, stopOnEntry bool) error {
+	if s.debugger != nil {
+		return fmt.Errorf("A program is already launched.")
+	}
+	source, err := os.ReadFile(program)
+	if err != nil {
+		return err
+	}
+	err = setupConfig(program)
+	if err != nil {
+		return err
+	}
+
+	var messages bytes.Buffer
+	interpreter := NewInterpreter().WithOutput(&dapOutput{server: s, category: "stdout"}, &dapOutput{server: s, category: "stderr"})
+	debugger := NewDebugger(interpreter, s.pause)
+	stmts, err := compileSource(string(source), interpreter, NewErrorReporter(&messages), false)
+	if err != nil {
+		return errors.New(strings.TrimSpace(messages.String()))
+	}
+	if !stopOnEntry {
+		debugger.Resume(StepContinue)
+	}
+
+	s.program = program
+	s.interpreter = interpreter
+	s.debugger = debugger
+	s.stmts = stmts
+	return nil
+}
+
+func (s *DapServer) start() error {
+	if s.debugger == nil {
+		return fmt.Errorf("No program was launched.")
+	}
+	if s.isStarted {
+		return nil
+	}
+	s.isStarted = true
+	go func() {
+		err := s.interpreter.interpret(s.stmts)
+		code := 0
+		if err != nil && !errors.Is(err, errDebuggerQuit) {
+			fmt.Fprintln(s.interpreter.stderr, err)
+			code = exitCode(err)
+		}
+		s.event("exited", map[string]any{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+	return nil
+}
+
+// Ends the script, whether it is paused or running
+func (s *DapServer) stop() {
+	s.mu.Lock()
+	isPaused := s.isPaused
+	s.mu.Unlock()
+	if isPaused {
+		s.resume <- dapResume{isQuit: true}
+	} else if s.interpreter != nil {
+		s.interpreter.Interrupt()
+	}
+}
+
+// Called on the script goroutine, it blocks until a request resumes the execution
+func (s *DapServer) pause(reason string) error {
+	s.mu.Lock()
+	s.isPaused = true
+	s.mu.Unlock()
+	s.event("stopped", map[string]any{"reason": reason, "threadId": dapThreadID, "allThreadsStopped": true})
+
+	resume := <-s.resume
+	if resume.isQuit {
+		return errDebuggerQuit
+	}
+	s.debugger.Resume(resume.mode)
+	return nil
+}
+
+func (s *DapServer) continueWith(mode StepMode) error {
+	s.mu.Lock()
+	if !s.isPaused {
+		s.mu.Unlock()
+		return fmt.Errorf("The program isn't paused.")
+	}
+	s.isPaused = false
+	// References are only valid during the pause that handed them out
+	s.handles = nil
+	s.mu.Unlock()
+	s.resume <- dapResume{mode: mode}
+	return nil
+}
+
+// The script goroutine is blocked in [DapServer.pause] while [inspect] runs
+func (s *DapServer) whilePaused(inspect func() (any, error)) (any, error) {
+	s.mu.Lock()
+	isPaused := s.isPaused
+	s.mu.Unlock()
+	if !isPaused {
+		return nil, fmt.Errorf("The program isn't paused.")
+	}
+	return inspect()
+}
+
+func (s *DapServer) reference(value any) int {
+	s.handles = append(s.handles, value)
+	return len(s.handles)
+}
+
+// Children of an environment, an instance or the globals
+func (s *DapServer) variables(container any) []dapVariable {
+	variables := []dapVariable{}
+	switch container := container.(type) {
+	case dapGlobals:
+		for _, global := range s.debugger.Globals() {
+			variables = append(variables, s.variable(global.Name, global.Value))
+		}
+	case *Environment:
+		for index, value := range container.localValues {
+			variables = append(variables, s.variable(container.name(index), value))
+		}
+		// The chain stops before the environment of the script, its variables are the globals
+		if container.enclosing != nil && container.enclosing.enclosing != nil {
+			variables = append(variables, dapVariable{
+				Name:               "<enclosing>",
+				Value:              "enclosing scope",
+				VariablesReference: s.reference(container.enclosing),
+			})
+		}
+	case *LoxInstance:
+		names := []string{}
+		for name := range container.fields {
+			names = append(names, name)
+		}
+		// Arrays are instances indexed by numbers
+		slices.SortFunc(names, func(a, b string) int {
+			indexA, errA := strconv.Atoi(a)
+			indexB, errB := strconv.Atoi(b)
+			if errA == nil && errB == nil {
+				return indexA - indexB
+			}
+			return strings.Compare(a, b)
+		})
+		for _, name := range names {
+			variables = append(variables, s.variable(name, container.fields[name]))
+		}
+	}
+	return variables
+}
+
+func (s *DapServer) variable(name string, value any) dapVariable {
+	variable := dapVariable{Name: name, Value: debugValue(value)}
+	switch value := value.(type) {
+	case nil:
+		variable.Type = "nil"
+	case bool:
+		variable.Type = "boolean"
+	case float64:
+		variable.Type = "number"
+	case []byte, string:
+		variable.Type = "string"
+	case *LoxInstance:
+		variable.Type = value.class.name
+		if len(value.fields) > 0 {
+			variable.VariablesReference = s.reference(value)
+		}
+	case *LoxClass:
+		variable.Type = "class"
+	case Callable:
+		variable.Type = "function"
+	}
+	return variable
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Forwards the output of the script as `output` events
+type dapOutput struct {
+	server   *DapServer
+	category string
+}
+
+func (o *dapOutput) Write(bytes []byte) (int, error) {
+	o.server.event("output", map[string]any{"category": o.category, "output": string(bytes)})
+	return len(bytes), nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `Commands:
+  break <line> [if <cond>]  pause at the line, only when the condition is true if given (b)
+  delete [line]             remove the breakpoint of the line, or all of them (d)
+  info                      list the breakpoints
+  continue                  run until the next breakpoint (c)
+  step                      run to the next line, entering calls (s)
+  next                      run to the next line, stepping over calls (n)
+  finish                    run until the current function returns (out)
+  backtrace                 show the call stack (bt)
+  frame <n>                 select the frame to print in (f)
+  print <expr>              evaluate the expression in the selected frame (p)
+  locals                    list the variables of the selected frame
+  globals                   list the global variables
+  list                      show the source around the paused line (l)
+  quit                      abort the script (q)
+  help                      show this message (h)
+An empty line repeats the last command.`
+
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox debug [flags] <script>")
+		fmt.Fprintln(os.Stderr, "Runs the script paused on its first line, type `help` at the prompt for the commands")
+		flags.PrintDefaults()
+	}
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return debugFile(flags.Arg(0), os.Stdin, os.Stdout)
+}
+
+func debugFile(filePath string, in io.Reader, out io.Writer) error {
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+
+	interpreter := NewInterpreter()
+	console := NewDebugConsole(source, in, out)
+	// Attached before resolving so the scopes keep the names of their variables
+	console.debugger = NewDebugger(interpreter, console.pause)
+	stmts, err := compileSource(source, interpreter, NewErrorReporter(interpreter.stderr), false)
+	if err != nil {
+		return err
+	}
+
+	err = interpreter.interpret(stmts)
+	if errors.Is(err, errDebuggerQuit) {
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintln(interpreter.stderr, err)
+		return err
+	}
+	fmt.Fprintln(out, "Script finished.")
+	return nil
+}
+
+// Line based frontend of the debugger
+type DebugConsole struct {
+	debugger    *Debugger
+	reader      *bufio.Reader
+	out         io.Writer
+	lines       []string
+	lastCommand string
+	// Selected frame, counted from the innermost one
+	frame int
+}
+
+func NewDebugConsole(source string, in io.Reader, out io.Writer) *DebugConsole {
+	return &DebugConsole{
+		reader: bufio.NewReader(in),
+		out:    out,
+		lines:  strings.Split(source, "\n"),
+	}
+}
+
+// Reads commands until one resumes the script
+func (c *DebugConsole) pause(reason string) error {
+	c.frame = 0
+	line := c.debugger.Frames()[0].Line()
+	fmt.Fprintf(c.out, "Paused at line %d (%v)\n", line, reason)
+	c.printLine(line, true)
+
+	for {
+		fmt.Fprint(c.out, "(glox) ")
+		input, err := c.reader.ReadString('\n')
+		if err != nil && input == "" {
+			fmt.Fprintln(c.out)
+			return errDebuggerQuit
+		}
+		command := strings.TrimSpace(input)
+		if command == "" {
+			command = c.lastCommand
+		}
+		c.lastCommand = command
+
+		isResumed, err := c.execute(command)
+		if errors.Is(err, errDebuggerQuit) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(c.out, err)
+			continue
+		}
+		if isResumed {
+			return nil
+		}
+	}
+}
+
+func (c *DebugConsole) execute(command string) (isResumed bool, err error) {
+	name, argument, _ := strings.Cut(command, " ")
+	argument = strings.TrimSpace(argument)
+	switch name {
+	case "":
+		return false, nil
+	case "break", "b":
+		return false, c.setBreakpoint(argument)
+	case "delete", "d":
+		if argument == "" {
+			c.debugger.ClearBreakpoints()
+			return false, nil
+		}
+		line, err := strconv.Atoi(argument)
+		if err != nil {
+			return false, fmt.Errorf("Expect a line number.")
+		}
+		if !c.debugger.ClearBreakpoint(line) {
+			return false, fmt.Errorf("No breakpoint at line %d.", line)
+		}
+		return false, nil
+	case "info":
+		breakpoints := c.debugger.Breakpoints()
+		if len(breakpoints) == 0 {
+			fmt.Fprintln(c.out, "No breakpoints.")
+		}
+		for _, breakpoint := range breakpoints {
+			fmt.Fprintf(c.out, "line %d", breakpoint.Line)
+			if breakpoint.Condition != "" {
+				fmt.Fprintf(c.out, " if %v", breakpoint.Condition)
+			}
+			fmt.Fprintf(c.out, ", hit %d times\n", breakpoint.Hits)
+		}
+		return false, nil
+	case "continue", "c":
+		c.debugger.Resume(StepContinue)
+		return true, nil
+	case "step", "s":
+		c.debugger.Resume(StepIn)
+		return true, nil
+	case "next", "n":
+		c.debugger.Resume(StepOver)
+		return true, nil
+	case "finish", "out":
+		c.debugger.Resume(StepOut)
+		return true, nil
+	case "backtrace", "bt":
+		for i, frame := range c.debugger.Frames() {
+			marker := " "
+			if i == c.frame {
+				marker = "*"
+			}
+			fmt.Fprintf(c.out, "%v#%d %v at line %d\n", marker, i, frame.Name, frame.Line())
+		}
+		return false, nil
+	case "frame", "f":
+		frame, err := strconv.Atoi(argument)
+		if err != nil {
+			return false, fmt.Errorf("Expect a frame number.")
+		}
+		frames := c.debugger.Frames()
+		if frame < 0 || frame >= len(frames) {
+			return false, fmt.Errorf("No frame %d.", frame)
+		}
+		c.frame = frame
+		fmt.Fprintf(c.out, "#%d %v at line %d\n", frame, frames[frame].Name, frames[frame].Line())
+		return false, nil
+	case "print", "p":
+		if argument == "" {
+			return false, fmt.Errorf("Expect an expression.")
+		}
+		value, err := c.debugger.Evaluate(argument, c.frame)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(c.out, debugValue(value))
+		return false, nil
+	case "locals":
+		c.printVariables(c.debugger.Locals(c.frame))
+		return false, nil
+	case "globals":
+		c.printVariables(c.debugger.Globals())
+		return false, nil
+	case "list", "l":
+		line := c.debugger.Frames()[c.frame].Line()
+		for i := max(1, line-5); i <= min(len(c.lines), line+5); i++ {
+			c.printLine(i, i == line)
+		}
+		return false, nil
+	case "quit", "q":
+		return false, errDebuggerQuit
+	case "help", "h":
+		fmt.Fprintln(c.out, debugHelp)
+		return false, nil
+	}
+	return false, fmt.Errorf("Unknown command '%v', type `help` for the list.", name)
+}
+
+// Parses `<line> [if <condition>]`
+func (c *DebugConsole) setBreakpoint(argument string) error {
+	lineText, condition, _ := strings.Cut(argument, " ")
+	condition = strings.TrimSpace(condition)
+	if condition != "" {
+		var ok bool
+		condition, ok = strings.CutPrefix(condition, "if ")
+		if !ok {
+			return fmt.Errorf("Expect 'if' before the condition.")
+		}
+	}
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 || line > len(c.lines) {
+		return fmt.Errorf("Expect a line number of the script.")
+	}
+	_, err = c.debugger.SetBreakpoint(line, strings.TrimSpace(condition))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Breakpoint at line %d\n", line)
+	return nil
+}
+
+func (c *DebugConsole) printLine(line int, isCurrent bool) {
+	if line < 1 || line > len(c.lines) {
+		return
+	}
+	marker := " "
+	if isCurrent {
+		marker = ">"
+	}
+	fmt.Fprintf(c.out, "%v %4d | %v\n", marker, line, strings.TrimRight(c.lines[line-1], "\r"))
+}
+
+func (c *DebugConsole) printVariables(variables []DebugVariable) {
+	if len(variables) == 0 {
+		fmt.Fprintln(c.out, "No variables.")
+	}
+	for _, variable := range variables {
+		fmt.Fprintf(c.out, "%v = %v\n", variable.Name, debugValue(variable.Value))
+	}
+}
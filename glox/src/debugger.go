@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Returned from a pause to abort the script being debugged
+var errDebuggerQuit = errors.New("debugger quit")
+
+// How the execution goes on after a pause
+type StepMode int
+
+const (
+	// Run until a breakpoint
+	StepContinue StepMode = iota
+	// Pause at the next line, entering calls
+	StepIn
+	// Pause at the next line of the current function or of its callers
+	StepOver
+	// Pause once back in the caller
+	StepOut
+)
+
+type Breakpoint struct {
+	Line int
+	// Source of the condition, empty when the breakpoint always pauses
+	Condition string
+	Hits      int
+	// Parsed once when set, `nil` without condition
+	condition *DebugExpression
+}
+
+// Expression typed by the user, resolved in the scopes of the frame evaluating it
+type DebugExpression struct {
+	expr Expr
+	// Positions of its variables, only added to the interpreter's while it is evaluated so they don't pile up
+	locals map[Expr]*Position
+	// Names of the slots of the environments it was resolved in, innermost first
+	shape [][]string
+}
+
+// Lox function being executed, the script itself is the bottom frame
+type CallFrame struct {
+	Name string
+	// Statement about to run, or running when the frame is a caller
+	Stmt        Stmt
+	Environment *Environment
+	// Line that last paused or could have, `0` when the next statement can pause on any line
+	pauseLine int
+}
+
+func (f *CallFrame) Line() int {
+	if f.Stmt == nil {
+		return 0
+	}
+	return f.Stmt.firstToken().Line
+}
+
+// Pauses the interpreter between statements, frontends like `glox debug` decide how to resume
+type Debugger struct {
+	interpreter *Interpreter
+	// Guards the breakpoints, frontends may change them while the script runs
+	mu          sync.Mutex
+	breakpoints map[int]*Breakpoint
+	frames      []*CallFrame
+	mode        StepMode
+	// Number of frames when the step started
+	stepDepth int
+	// Called on each pause with the reason (entry, step, breakpoint or pause) until the execution resumes,
+	// the returned error aborts the script
+	onPause func(reason string) error
+	// Set while evaluating for the user so calls in the expression run without pausing
+	isEvaluating bool
+	// Set from another goroutine to pause at the next statement
+	pauseRequested atomic.Bool
+}
+
+// The scope metadata is only recorded when the debugger is attached before resolving
+func NewDebugger(interpreter *Interpreter, onPause func(reason string) error) *Debugger {
+	debugger := &Debugger{
+		interpreter: interpreter,
+		breakpoints: map[int]*Breakpoint{},
+		frames:      []*CallFrame{{Name: "<script>", Environment: interpreter.enviroment}},
+		// Pauses on the first statement so that breakpoints can be set
+		mode:    StepIn,
+		onPause: onPause,
+	}
+	interpreter.debugger = debugger
+	interpreter.scopeNames = map[any][]string{}
+	return debugger
+}
+
+// Replaces the breakpoint of the line, [condition] is a Lox expression or empty
+func (d *Debugger) SetBreakpoint(line int, condition string) (*Breakpoint, error) {
+	breakpoint := &Breakpoint{Line: line, Condition: condition}
+	if condition != "" {
+		expr, err := d.parseExpression(condition)
+		if err != nil {
+			return nil, err
+		}
+		breakpoint.condition = &DebugExpression{expr: expr}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[line] = breakpoint
+	return breakpoint, nil
+}
+
+func (d *Debugger) ClearBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.breakpoints[line]
+	delete(d.breakpoints, line)
+	return ok
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.breakpoints)
+}
+
+// Sorted by line
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	breakpoints := []*Breakpoint{}
+	for _, breakpoint := range d.breakpoints {
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	slices.SortFunc(breakpoints, func(a, b *Breakpoint) int {
+		return a.Line - b.Line
+	})
+	return breakpoints
+}
+
+// Innermost frame first
+func (d *Debugger) Frames() []*CallFrame {
+	frames := slices.Clone(d.frames)
+	slices.Reverse(frames)
+	return frames
+}
+
+func (d *Debugger) Resume(mode StepMode) {
+	d.mode = mode
+	d.stepDepth = len(d.frames)
+}
+
+// Safe to call while the script runs, it pauses before the next statement
+func (d *Debugger) RequestPause() {
+	d.pauseRequested.Store(true)
+}
+
+func (d *Debugger) enterCall(function *Function) {
+	d.frames = append(d.frames, &CallFrame{Name: function.name()})
+}
+
+func (d *Debugger) exitCall() {
+	d.frames = d.frames[:len(d.frames)-1]
+	// Once the stepping frame returns the step ends in its caller, not in the next function it calls
+	if (d.mode == StepOver || d.mode == StepOut) && len(d.frames) < d.stepDepth {
+		d.mode = StepOver
+		d.stepDepth = len(d.frames)
+	}
+}
+
+func (d *Debugger) beforeStatement(stmt Stmt) error {
+	if d.isEvaluating {
+		return nil
+	}
+	frame := d.frames[len(d.frames)-1]
+	frame.Stmt = stmt
+	frame.Environment = d.interpreter.enviroment
+
+	// Only the first statement of a line pauses
+	line := stmt.firstToken().Line
+	previousLine := frame.pauseLine
+	frame.pauseLine = line
+	if _, ok := stmt.(*StmtBlock); ok {
+		// Blocks pause on their first statement instead, a loop body starting on another line than
+		// the statement before pauses again on each iteration
+		if line != previousLine {
+			frame.pauseLine = 0
+		}
+		return nil
+	}
+	// Requested pauses can't wait for another line, a loop might never leave it
+	if d.pauseRequested.Swap(false) {
+		d.mode = StepContinue
+		return d.onPause("pause")
+	}
+	if line == previousLine {
+		return nil
+	}
+
+	reason := ""
+	depth := len(d.frames)
+	switch {
+	case d.mode == StepIn && d.stepDepth == 0:
+		reason = "entry"
+	case d.mode == StepIn,
+		d.mode == StepOver && depth <= d.stepDepth,
+		d.mode == StepOut && depth < d.stepDepth:
+		reason = "step"
+	case d.isBreakpointHit(line):
+		reason = "breakpoint"
+	}
+	if reason == "" {
+		return nil
+	}
+	d.mode = StepContinue
+	return d.onPause(reason)
+}
+
+// Conditions failing to evaluate are reported and pause like a hit
+func (d *Debugger) isBreakpointHit(line int) bool {
+	d.mu.Lock()
+	breakpoint, ok := d.breakpoints[line]
+	d.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if breakpoint.condition != nil {
+		value, err := d.evaluateIn(breakpoint.condition, d.frames[len(d.frames)-1].Environment)
+		if err != nil {
+			fmt.Fprintf(d.interpreter.stderr, "Breakpoint condition at line %d failed: %v\n", line, err)
+		} else if !isTruthy(value) {
+			return false
+		}
+	}
+	d.mu.Lock()
+	breakpoint.Hits++
+	d.mu.Unlock()
+	return true
+}
+
+func (d *Debugger) parseExpression(source string) (Expr, error) {
+	reporter := NewErrorReporter(io.Discard)
+	scanner := NewScanner(source, d.interpreter.config, reporter)
+	err := scanner.scanTokens()
+	if err != nil {
+		return nil, err
+	}
+	parser := NewParser(scanner.Tokens, d.interpreter.config, reporter)
+	expr, err := parser.commaOperator()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.isAtEnd() {
+		return nil, NewParserError(parser.peek(), "Expect end of expression.")
+	}
+	return expr, nil
+}
+
+// Evaluates [source] in the frame at [frameIndex], counted from the innermost one
+func (d *Debugger) Evaluate(source string, frameIndex int) (any, error) {
+	if frameIndex < 0 || frameIndex >= len(d.frames) {
+		return nil, fmt.Errorf("No frame %d.", frameIndex)
+	}
+	expr, err := d.parseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return d.evaluateIn(&DebugExpression{expr: expr}, d.frames[len(d.frames)-1-frameIndex].Environment)
+}
+
+// Resolves [expression] again only when the scopes of [env] differ from the ones it was resolved in
+func (d *Debugger) evaluateIn(expression *DebugExpression, env *Environment) (any, error) {
+	if !expression.isResolvedIn(env) {
+		err := d.resolveIn(expression, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for expr, position := range expression.locals {
+		d.interpreter.locals[expr] = position
+	}
+	enviroment := d.interpreter.enviroment
+	d.interpreter.enviroment = env
+	d.isEvaluating = true
+	defer func() {
+		d.interpreter.enviroment = enviroment
+		d.isEvaluating = false
+		for expr := range expression.locals {
+			delete(d.interpreter.locals, expr)
+		}
+	}()
+	value, err := d.interpreter.evaluate(expression.expr)
+	if runtimeErr, ok := err.(*RuntimeError); ok {
+		// The line is the one of the expression typed by the user, not of the script
+		return nil, errors.New(runtimeErr.message)
+	}
+	return value, err
+}
+
+// The locals are resolved by name from the scopes of the environment chain, into a map of their own
+func (d *Debugger) resolveIn(expression *DebugExpression, env *Environment) error {
+	var messages strings.Builder
+	reporter := NewErrorReporter(&messages)
+	scratch := &Interpreter{locals: map[Expr]*Position{}}
+	resolver := NewResolver(scratch, d.interpreter.config, reporter)
+	shape := [][]string{}
+	for ; env != nil && env.enclosing != nil; env = env.enclosing {
+		names := []string{}
+		for index := range env.localValues {
+			names = append(names, env.name(index))
+		}
+		shape = append(shape, names)
+	}
+	for _, names := range slices.Backward(shape) {
+		resolver.beginScope()
+		scope := resolver.scopes.peek()
+		for _, name := range names {
+			token := NewToken(Identifier, name, nil, 0)
+			scope.NewLocalVariable(&token)
+			scope.variables[name].isInitialized = true
+			switch name {
+			case "this":
+				resolver.currentClass = max(resolver.currentClass, ClassTypeClass)
+			case "super":
+				resolver.currentClass = ClassTypeSubclass
+			}
+		}
+	}
+	resolver.resolveExpr(expression.expr)
+	if reporter.hadError {
+		return errors.New(strings.TrimSpace(messages.String()))
+	}
+	expression.locals = scratch.locals
+	expression.shape = shape
+	return nil
+}
+
+func (expression *DebugExpression) isResolvedIn(env *Environment) bool {
+	if expression.shape == nil {
+		return false
+	}
+	for _, names := range expression.shape {
+		if env == nil || env.enclosing == nil || len(env.localValues) != len(names) {
+			return false
+		}
+		for index, name := range names {
+			if env.name(index) != name {
+				return false
+			}
+		}
+		env = env.enclosing
+	}
+	return env == nil || env.enclosing == nil
+}
+
+// Variables of the frame by name, innermost scope first, the globals aren't included
+func (d *Debugger) Locals(frameIndex int) []DebugVariable {
+	if frameIndex < 0 || frameIndex >= len(d.frames) {
+		return nil
+	}
+	variables := []DebugVariable{}
+	for env := d.frames[len(d.frames)-1-frameIndex].Environment; env != nil && env.enclosing != nil; env = env.enclosing {
+		for index, value := range env.localValues {
+			variables = append(variables, DebugVariable{Name: env.name(index), Value: value})
+		}
+	}
+	return variables
+}
+
+// Sorted by name
+func (d *Debugger) Globals() []DebugVariable {
+	variables := []DebugVariable{}
+	for name, value := range d.interpreter.globals {
+		if _, ok := value.(*ProtoCallable); ok {
+			continue
+		}
+		variables = append(variables, DebugVariable{Name: name, Value: value})
+	}
+	slices.SortFunc(variables, func(a, b DebugVariable) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return variables
+}
+
+type DebugVariable struct {
+	Name  string
+	Value any
+}
+
+// Like `print` but strings are quoted to tell them apart from other values
+func debugValue(value any) string {
+	switch value := value.(type) {
+	case []byte:
+		return fmt.Sprintf("%q", value)
+	case string:
+		return fmt.Sprintf("%q", value)
+	case Uninitialized:
+		return "<uninitialized>"
+	}
+	return string(stringify(value))
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+func docCommand(args []string) error {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox doc [flags] <path> [path ...]")
+		fmt.Fprintln(os.Stderr, "Generates the reference of the classes and functions of the scripts from their `///` and `/** */` comments")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "markdown", "output `format`: markdown or html")
+	output := flags.String("o", "", "write to `file` instead of the standard output")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if *format != "markdown" && *format != "html" {
+		return fmt.Errorf("Unknown format '%v', expect markdown or html.", *format)
+	}
+
+	files, err := loxFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	docs := []*FileDoc{}
+	for _, file := range files {
+		doc, err := documentFile(file)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if *format == "html" {
+		_, err = io.WriteString(out, docsHTML(docs))
+	} else {
+		_, err = io.WriteString(out, docsMarkdown(docs))
+	}
+	return err
+}
+
+// Top level classes and functions of a script, in source order
+type FileDoc struct {
+	Path  string
+	Stmts []Stmt
+}
+
+func documentFile(filePath string) (*FileDoc, error) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	err = setupConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	reporter := NewErrorReporter(os.Stderr)
+	config := SourceConfig(string(source), &GlobalConfig, reporter)
+	// Comments are only kept as trivia when scanning losslessly
+	stmts, _, err := parseSource(string(source), config, reporter, true, false)
+	if err != nil {
+		return nil, err
+	}
+	doc := &FileDoc{Path: filePath}
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *StmtClass, *StmtFunction:
+			doc.Stmts = append(doc.Stmts, stmt)
+		}
+	}
+	return doc, nil
+}
+
+// Text of the doc comment right above [token]: consecutive `///` lines or a `/** */` block,
+// a blank line in between detaches it
+func docComment(token *Token) string {
+	newlines := 0
+	lines := []string{}
+	for i := len(token.LeadingTrivia) - 1; i >= 0; i-- {
+		trivia := token.LeadingTrivia[i]
+		switch trivia.Kind {
+		case TriviaWhitespace:
+			continue
+		case TriviaNewline:
+			newlines++
+			if newlines > 1 {
+				return strings.Join(lines, "\n")
+			}
+			continue
+		case TriviaLineComment:
+			text, ok := strings.CutPrefix(trivia.Text, "///")
+			if !ok || strings.HasPrefix(text, "/") {
+				return strings.Join(lines, "\n")
+			}
+			lines = slices.Insert(lines, 0, strings.TrimPrefix(text, " "))
+			newlines = 0
+			continue
+		case TriviaBlockComment:
+			if len(lines) == 0 && strings.HasPrefix(trivia.Text, "/**") && trivia.Text != "/**/" {
+				return blockDoc(trivia.Text)
+			}
+		}
+		break
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Strips the delimiters of a `/** */` comment and the `*` starting its lines
+func blockDoc(comment string) string {
+	text := strings.TrimSuffix(strings.TrimPrefix(comment, "/**"), "*/")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "*" {
+			line = ""
+		} else if rest, ok := strings.CutPrefix(line, "* "); ok {
+			line = rest
+		}
+		lines[i] = line
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Members of a class grouped as they are listed
+type classMembers struct {
+	methods       []*StmtFunction
+	getters       []*StmtFunction
+	staticMethods []*StmtFunction
+}
+
+func membersOf(class *StmtClass) classMembers {
+	members := classMembers{staticMethods: class.staticMethods}
+	for _, method := range class.methods {
+		if method.function.params == nil {
+			members.getters = append(members.getters, method)
+		} else {
+			members.methods = append(members.methods, method)
+		}
+	}
+	return members
+}
+
+func signature(function *StmtFunction) string {
+	if function.function.params == nil {
+		return function.name.Lexeme
+	}
+	params := []string{}
+	for _, param := range function.function.params {
+		params = append(params, param.Lexeme)
+	}
+	return fmt.Sprintf("%v(%v)", function.name.Lexeme, strings.Join(params, ", "))
+}
+
+func classTitle(class *StmtClass) string {
+	if class.superclass != nil {
+		return fmt.Sprintf("class %v < %v", class.name.Lexeme, class.superclass.name.Lexeme)
+	}
+	return "class " + class.name.Lexeme
+}
+
+func docsMarkdown(docs []*FileDoc) string {
+	var builder strings.Builder
+	for i, doc := range docs {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(&builder, "# %v\n", doc.Path)
+		for _, stmt := range doc.Stmts {
+			switch stmt := stmt.(type) {
+			case *StmtFunction:
+				fmt.Fprintf(&builder, "\n## fun %v\n", signature(stmt))
+				markdownParagraph(&builder, stmt.doc)
+			case *StmtClass:
+				fmt.Fprintf(&builder, "\n## %v\n", classTitle(stmt))
+				markdownParagraph(&builder, stmt.doc)
+				members := membersOf(stmt)
+				markdownMembers(&builder, "Methods", stmt.name.Lexeme+".", members.methods)
+				markdownMembers(&builder, "Getters", stmt.name.Lexeme+".", members.getters)
+				markdownMembers(&builder, "Static methods", "class "+stmt.name.Lexeme+".", members.staticMethods)
+			}
+		}
+	}
+	return builder.String()
+}
+
+func markdownMembers(builder *strings.Builder, title, prefix string, functions []*StmtFunction) {
+	if len(functions) == 0 {
+		return
+	}
+	fmt.Fprintf(builder, "\n### %v\n", title)
+	for _, function := range functions {
+		fmt.Fprintf(builder, "\n#### %v%v\n", prefix, signature(function))
+		markdownParagraph(builder, function.doc)
+	}
+}
+
+func markdownParagraph(builder *strings.Builder, doc string) {
+	if doc != "" {
+		fmt.Fprintf(builder, "\n%v\n", doc)
+	}
+}
+
+const docStyle = `body { font-family: sans-serif; margin: 2em auto; max-width: 50em; }
+code, h2, h3, h4 { font-family: monospace; }
+h1 { font-family: sans-serif; border-bottom: 1px solid #ccc; }
+h3 { color: #555; }
+.doc { white-space: pre-wrap; }`
+
+// A standalone page with a table of contents, the doc comments are shown as plain text
+func docsHTML(docs []*FileDoc) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Lox reference</title>\n<style>\n%v\n</style>\n</head>\n<body>\n", docStyle)
+	builder.WriteString("<nav>\n<ul>\n")
+	for i, doc := range docs {
+		fmt.Fprintf(&builder, "<li><a href=\"#%v\">%v</a>\n<ul>\n", htmlID(i, ""), html.EscapeString(doc.Path))
+		for _, stmt := range doc.Stmts {
+			name := stmt.firstToken().Lexeme
+			fmt.Fprintf(&builder, "<li><a href=\"#%v\"><code>%v</code></a></li>\n", htmlID(i, name), html.EscapeString(name))
+		}
+		builder.WriteString("</ul>\n</li>\n")
+	}
+	builder.WriteString("</ul>\n</nav>\n")
+
+	for i, doc := range docs {
+		fmt.Fprintf(&builder, "<h1 id=\"%v\">%v</h1>\n", htmlID(i, ""), html.EscapeString(doc.Path))
+		for _, stmt := range doc.Stmts {
+			id := htmlID(i, stmt.firstToken().Lexeme)
+			switch stmt := stmt.(type) {
+			case *StmtFunction:
+				fmt.Fprintf(&builder, "<h2 id=\"%v\">fun %v</h2>\n", id, html.EscapeString(signature(stmt)))
+				htmlParagraph(&builder, stmt.doc)
+			case *StmtClass:
+				fmt.Fprintf(&builder, "<h2 id=\"%v\">%v</h2>\n", id, html.EscapeString(classTitle(stmt)))
+				htmlParagraph(&builder, stmt.doc)
+				members := membersOf(stmt)
+				htmlMembers(&builder, "Methods", stmt.name.Lexeme+".", members.methods)
+				htmlMembers(&builder, "Getters", stmt.name.Lexeme+".", members.getters)
+				htmlMembers(&builder, "Static methods", "class "+stmt.name.Lexeme+".", members.staticMethods)
+			}
+		}
+	}
+	builder.WriteString("</body>\n</html>\n")
+	return builder.String()
+}
+
+func htmlMembers(builder *strings.Builder, title, prefix string, functions []*StmtFunction) {
+	if len(functions) == 0 {
+		return
+	}
+	fmt.Fprintf(builder, "<h3>%v</h3>\n", title)
+	for _, function := range functions {
+		fmt.Fprintf(builder, "<h4>%v</h4>\n", html.EscapeString(prefix+signature(function)))
+		htmlParagraph(builder, function.doc)
+	}
+}
+
+func htmlParagraph(builder *strings.Builder, doc string) {
+	if doc != "" {
+		fmt.Fprintf(builder, "<p class=\"doc\">%v</p>\n", html.EscapeString(doc))
+	}
+}
+
+// Anchors are unique per file, declarations being global names
+func htmlID(file int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("file-%d", file)
+	}
+	return fmt.Sprintf("file-%d-%v", file, name)
+}
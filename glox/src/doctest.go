@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var errDoctestFailures = errors.New("doctest failures")
+
+// `print x; // => 3` expects the line `3` in the output
+var doctestExpectPattern = regexp.MustCompile(`//\s*=>\s?(.*)$`)
+
+// Lines of the errors, counted from the start of the block
+var doctestErrorLinePattern = regexp.MustCompile(`\[line (\d+)\]`)
+
+func doctestCommand(args []string) error {
+	flags := flag.NewFlagSet("doctest", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox doctest [flags] <path> [path ...]")
+		fmt.Fprintln(os.Stderr, "Runs the ```lox blocks of the Markdown files, each in a fresh interpreter, and compares their output")
+		fmt.Fprintln(os.Stderr, "with the ```output block right after them or with their `// =>` comments, ```lox skip blocks aren't run")
+		flags.PrintDefaults()
+	}
+	verbose := flags.Bool("v", false, "list the blocks passing too")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	files, err := markdownFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		err = setupConfig(file)
+		if err != nil {
+			return err
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, doctest := range extractDoctests(string(source)) {
+			failures := doctest.run()
+			if len(failures) == 0 {
+				passed++
+				if *verbose {
+					fmt.Printf("PASS %v:%d\n", file, doctest.Line)
+				}
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %v:%d\n", file, doctest.Line)
+			for _, failure := range failures {
+				fmt.Printf("     %v:%v\n", file, failure)
+			}
+		}
+	}
+	fmt.Printf("doctest: %d passed, %d failed.\n", passed, failed)
+	if failed > 0 {
+		return errDoctestFailures
+	}
+	return nil
+}
+
+// The Markdown files of the directories, files given explicitly are kept whatever their extension
+func markdownFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && filepath.Ext(file) == ".md" {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// A ```lox block of a Markdown file with the output it expects
+type Doctest struct {
+	// Lines of the opening and closing fences
+	Line   int
+	end    int
+	source string
+	// `nil` when the block expects nothing, it then only has to run without errors
+	expected []doctestLine
+}
+
+// An expected line of output and the line of the Markdown file stating it
+type doctestLine struct {
+	line int
+	text string
+}
+
+type markdownFence struct {
+	line   int
+	marker string
+	info   []string
+	lines  []string
+}
+
+// Fenced blocks opened by ``` or ~~~, the closing fence being at least as long as the opening one
+func markdownFences(markdown string) []*markdownFence {
+	fences := []*markdownFence{}
+	var fence *markdownFence
+	for i, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != nil {
+			if strings.HasPrefix(trimmed, fence.marker) && strings.Trim(trimmed, fence.marker[:1]) == "" {
+				fences = append(fences, fence)
+				fence = nil
+				continue
+			}
+			fence.lines = append(fence.lines, line)
+			continue
+		}
+		for _, char := range []string{"`", "~"} {
+			if !strings.HasPrefix(trimmed, strings.Repeat(char, 3)) {
+				continue
+			}
+			info := strings.TrimLeft(trimmed, char)
+			marker := trimmed[:len(trimmed)-len(info)]
+			// `lox,skip` and `lox skip` are both used for the attributes
+			fence = &markdownFence{line: i + 1, marker: marker, info: strings.Fields(strings.ReplaceAll(info, ",", " "))}
+		}
+	}
+	return fences
+}
+
+func (f *markdownFence) language() string {
+	if len(f.info) == 0 {
+		return ""
+	}
+	return f.info[0]
+}
+
+// Pairs each ```lox block with the ```output block following it, otherwise with its `// =>` comments
+func extractDoctests(markdown string) []*Doctest {
+	fences := markdownFences(markdown)
+	lines := strings.Split(markdown, "\n")
+	doctests := []*Doctest{}
+	for i, fence := range fences {
+		if fence.language() != "lox" || strings.Contains(strings.Join(fence.info[1:], " "), "skip") {
+			continue
+		}
+		end := fence.line + len(fence.lines) + 1
+		doctest := &Doctest{Line: fence.line, end: end, source: strings.Join(fence.lines, "\n")}
+		if i+1 < len(fences) && fences[i+1].language() == "output" && isBlank(lines[end:fences[i+1].line-1]) {
+			output := fences[i+1]
+			doctest.expected = []doctestLine{}
+			for j, text := range output.lines {
+				doctest.expected = append(doctest.expected, doctestLine{output.line + 1 + j, text})
+			}
+		} else {
+			for j, text := range fence.lines {
+				if match := doctestExpectPattern.FindStringSubmatch(text); match != nil {
+					doctest.expected = append(doctest.expected, doctestLine{fence.line + 1 + j, match[1]})
+				}
+			}
+		}
+		doctests = append(doctests, doctest)
+	}
+	return doctests
+}
+
+func isBlank(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the block and returns the mismatches prefixed by their line in the Markdown file,
+// errors are part of the output so an ```output block can document them
+func (d *Doctest) run() []string {
+	var output bytes.Buffer
+	interpreter := NewInterpreter().WithOutput(&output, &output)
+	err := run(d.source, interpreter, false)
+	got := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if output.Len() == 0 {
+		got = nil
+	}
+
+	if d.expected == nil {
+		if err != nil {
+			return []string{d.errorFailure(output.String())}
+		}
+		return nil
+	}
+	failures := []string{}
+	for i, line := range got {
+		if i >= len(d.expected) {
+			failures = append(failures, fmt.Sprintf("%d: unexpected output '%v'", d.end, line))
+			continue
+		}
+		if expected := d.expected[i]; expected.text != line {
+			failures = append(failures, fmt.Sprintf("%d: expected '%v' and got '%v'", expected.line, expected.text, line))
+		}
+	}
+	for _, expected := range d.expected[min(len(got), len(d.expected)):] {
+		failures = append(failures, fmt.Sprintf("%d: missing output '%v'", expected.line, expected.text))
+	}
+	return failures
+}
+
+// The `[line N]` of the errors become lines of the Markdown file, the first one prefixing the failure
+func (d *Doctest) errorFailure(output string) string {
+	fileLine := func(match []string) int {
+		n, _ := strconv.Atoi(match[1])
+		return d.Line + n
+	}
+	line := d.Line
+	if match := doctestErrorLinePattern.FindStringSubmatch(output); match != nil {
+		line = fileLine(match)
+	}
+	message := doctestErrorLinePattern.ReplaceAllStringFunc(strings.TrimSpace(output), func(match string) string {
+		return fmt.Sprintf("[line %d]", fileLine(doctestErrorLinePattern.FindStringSubmatch(match)))
+	})
+	return fmt.Sprintf("%d: %v", line, strings.ReplaceAll(message, "\n", " "))
+}
@@ -1,9 +1,13 @@
 package main
 
+import "fmt"
+
 type Environment struct {
 	// Parent-pointer tree (cactus stack)
 	enclosing   *Environment
 	localValues []any
+	// Variable names by slot, only known when the interpreter keeps the scopes (e.g. to debug)
+	names []string
 }
 
 type Uninitialized struct{}
@@ -20,6 +24,19 @@ func (env *Environment) WithEnclosing(enclosing *Environment) *Environment {
 	return env
 }
 
+func (env *Environment) WithNames(names []string) *Environment {
+	env.names = names
+	return env
+}
+
+// Name of the variable in the slot [index], the slot number when it isn't known
+func (env *Environment) name(index int) string {
+	if index < len(env.names) {
+		return env.names[index]
+	}
+	return fmt.Sprintf("<slot %d>", index)
+}
+
 func (env *Environment) define(v any) {
 	env.localValues = append(env.localValues, v)
 }
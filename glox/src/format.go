@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned by `glox fmt --check` when a file isn't formatted, the file names are already printed
+var errUnformatted = errors.New("files not formatted")
+
+func fmtCommand(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox fmt [flags] [path ...]")
+		fmt.Fprintln(os.Stderr, "Formats the scripts, or the .lox files in the directories, or the standard input")
+		flags.PrintDefaults()
+	}
+	check := flags.Bool("check", false, "list the files that aren't formatted and fail if there is any")
+	write := flags.Bool("w", false, "write the result to the file instead of the standard output")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("Can't use -w with the standard input.")
+		}
+		err = setupConfig("")
+		if err != nil {
+			return err
+		}
+		return formatStream("<stdin>", os.Stdin, *check)
+	}
+
+	files, err := loxFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fileErr := formatFile(file, *check, *write)
+		if fileErr != nil && (err == nil || errors.Is(err, errUnformatted)) {
+			err = fileErr
+		}
+	}
+	return err
+}
+
+// Expands directories to the .lox files they contain
+func loxFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && filepath.Ext(file) == ".lox" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func formatStream(name string, in io.Reader, check bool) error {
+	bytes, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+	formatted, err := formatSource(source, &GlobalConfig, NewErrorReporter(os.Stderr))
+	if err != nil {
+		return err
+	}
+	if check {
+		return checkFormatted(name, source, formatted)
+	}
+	fmt.Print(formatted)
+	return nil
+}
+
+func formatFile(filePath string, check, write bool) error {
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	// The project file of each script decides which features it can use
+	err = setupConfig(filePath)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+	formatted, err := formatSource(source, &GlobalConfig, NewErrorReporter(os.Stderr))
+	if err != nil {
+		if !isLoxError(err) {
+			return fmt.Errorf("%v: %w", filePath, err)
+		}
+		return err
+	}
+
+	if check {
+		err = checkFormatted(filePath, source, formatted)
+		if err != nil || !write {
+			return err
+		}
+	}
+	if write {
+		if formatted == source {
+			return nil
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filePath, []byte(formatted), info.Mode().Perm())
+	}
+	fmt.Print(formatted)
+	return nil
+}
+
+func checkFormatted(name, source, formatted string) error {
+	if source == formatted {
+		return nil
+	}
+	fmt.Println(name)
+	return errUnformatted
+}
+
+// Formats a whole script, the result is checked to parse back to the same AST
+func formatSource(source string, base *Config, reporter *ErrorReporter) (string, error) {
+	config := SourceConfig(source, base, reporter)
+	stmts, tokens, err := parseSource(source, config, reporter, true, false)
+	if err != nil {
+		return "", err
+	}
+
+	formatted, err := NewFormatter(tokens).format(stmts)
+	if err != nil {
+		return "", err
+	}
+
+	formattedStmts, _, err := parseSource(formatted, config, NewErrorReporter(io.Discard), false, false)
+	if err != nil || NewAstPrinter().printStmts(stmts) != NewAstPrinter().printStmts(formattedStmts) {
+		return "", fmt.Errorf("Formatting changed the meaning of the source, please report it.")
+	}
+	return formatted, nil
+}
+
+// Scans and parses a script without running it, errors are written to [reporter]
+func parseSource(source string, config *Config, reporter *ErrorReporter, isLossless, isReplMode bool) ([]Stmt, []*Token, error) {
+	scanner := NewScanner(source, config, reporter)
+	if isLossless {
+		scanner.WithLossless()
+	}
+	err := scanner.scanTokens()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parser := NewParser(scanner.Tokens, config, reporter).WithReplMode(isReplMode)
+	stmts, err := parser.parse()
+	if err != nil {
+		fmt.Fprintln(reporter.out, strings.TrimSpace(err.Error()))
+		return nil, nil, err
+	}
+	if reporter.hadError {
+		return nil, nil, NewParserError(parser.peek(), "Can't continue due to previous errors.")
+	}
+	return stmts, scanner.Tokens, nil
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	formatIndent = "    "
+	// Argument and parameter lists going past it are broken one item per line
+	formatMaxWidth = 80
+)
+
+// Prints the statements back to canonical source
+// The AST only drives the layout, every lexeme and comment comes from the lossless token stream
+// so the tokens are printed exactly in the order they were scanned
+type Formatter struct {
+	tokens  []*Token
+	current int
+	out     *strings.Builder
+	indent  int
+	// Layout requested before the next lexeme, applied lazily to never leave trailing whitespace
+	pendingNewlines int
+	pendingSpace    bool
+	// `true` when a line comment forced a line break the layout didn't ask for
+	isContinuation bool
+	// Line breaks in the source since the last printed lexeme or comment
+	sourceNewlines int
+	// Dry run used to measure lines, comments are skipped and lists are never broken
+	isMeasuring bool
+	// `true` right after an opening brace, blocks never start with a blank line
+	isBlockStart bool
+}
+
+// Raised when the AST doesn't match the token stream, which is a bug of the formatter
+type formatterError struct {
+	message string
+}
+
+func NewFormatter(tokens []*Token) *Formatter {
+	return &Formatter{
+		tokens: tokens,
+		out:    &strings.Builder{},
+	}
+}
+
+func (f *Formatter) format(stmts []Stmt) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(formatterError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("Can't format: %v.", e.message)
+		}
+	}()
+
+	f.stmtList(stmts)
+	// Comments at the end of the file
+	f.newline()
+	f.leadingTrivia(f.next(EOF))
+	if f.out.Len() > 0 {
+		f.out.WriteByte('\n')
+	}
+	return f.out.String(), nil
+}
+
+// Each statement on its own line, a single blank line between them is kept
+func (f *Formatter) stmtList(stmts []Stmt) {
+	for _, stmt := range stmts {
+		f.newline()
+		f.stmt(stmt)
+	}
+}
+
+func (f *Formatter) stmt(stmt Stmt) {
+	stmt.accept(f)
+}
+
+func (f *Formatter) expr(expr Expr) {
+	expr.accept(f)
+}
+
+func (f *Formatter) visitBlockStmt(stmt *StmtBlock) error {
+	if stmt.brace.Type == For {
+		// A `for` with an initializer is desugared into a block holding it and the loop
+		f.forLoop(stmt.block[0], stmt.block[1].(*StmtLoop))
+		return nil
+	}
+	f.block(stmt.block)
+	return nil
+}
+
+// `{` statements `}`, empty blocks without comments are kept on one line
+func (f *Formatter) block(stmts []Stmt) {
+	f.emit(LeftBrace)
+	f.isBlockStart = true
+	f.indent++
+	f.stmtList(stmts)
+	closing := f.next(RightBrace)
+	if len(stmts) > 0 || hasComments(closing.LeadingTrivia) || f.pendingNewlines > 0 {
+		// Comments before the closing brace belong to the block body
+		f.newline()
+		f.leadingTrivia(closing)
+		f.indent--
+		// Nor end with one
+		f.pendingNewlines = 1
+		f.isContinuation = false
+	} else {
+		f.indent--
+	}
+	f.write(closing.Lexeme)
+	f.trailingTrivia(closing)
+}
+
+func (f *Formatter) visitClassStmt(stmt *StmtClass) error {
+	f.emit(Class)
+	f.space()
+	f.emit(Identifier)
+	if stmt.superclass != nil {
+		f.space()
+		f.emit(Less)
+		f.space()
+		f.emit(Identifier)
+	}
+	f.space()
+
+	// Static methods are stored apart but are printed in the source order
+	methods := slices.Concat(stmt.methods, stmt.staticMethods)
+	slices.SortFunc(methods, func(a, b *StmtFunction) int {
+		return f.tokenIndex(a.name) - f.tokenIndex(b.name)
+	})
+	stmts := make([]Stmt, len(methods))
+	for i, method := range methods {
+		stmts[i] = method
+	}
+	f.block(stmts)
+	return nil
+}
+
+func (f *Formatter) visitFunctionStmt(stmt *StmtFunction) error {
+	switch f.peek().Type {
+	case Fun:
+		f.emit(Fun)
+		f.space()
+	case Class:
+		// Static method
+		f.emit(Class)
+		f.space()
+	}
+	f.emit(Identifier)
+	f.function(stmt.function)
+	return nil
+}
+
+// Parameters, if any as getters have none, and body
+func (f *Formatter) function(function *ExprFunction) {
+	if f.peek().Type == LeftParen {
+		f.emit(LeftParen)
+		f.list(RightParen, len(function.params), func(int) {
+			f.emit(Identifier)
+		})
+	}
+	f.space()
+	f.block(function.body)
+}
+
+func (f *Formatter) visitIfStmt(stmt *StmtIf) error {
+	f.emit(If)
+	f.space()
+	f.emit(LeftParen)
+	f.expr(stmt.condition)
+	f.emit(RightParen)
+	f.body(stmt.thenBranch)
+	if stmt.elseBranch == nil {
+		return nil
+	}
+
+	if block, ok := stmt.thenBranch.(*StmtBlock); ok && block.brace.Type == LeftBrace && f.pendingNewlines == 0 {
+		f.space()
+	} else {
+		// Also after a comment following the closing brace
+		f.newline()
+	}
+	f.emit(Else)
+	if _, ok := stmt.elseBranch.(*StmtIf); ok {
+		f.space()
+		f.stmt(stmt.elseBranch)
+	} else {
+		f.body(stmt.elseBranch)
+	}
+	return nil
+}
+
+// Blocks open on the same line, single statements are indented on the next one
+func (f *Formatter) body(stmt Stmt) {
+	if block, ok := stmt.(*StmtBlock); ok && block.brace.Type == LeftBrace {
+		f.space()
+		f.stmt(stmt)
+		return
+	}
+	f.indent++
+	f.newline()
+	f.stmt(stmt)
+	f.indent--
+}
+
+func (f *Formatter) visitLoopStmt(stmt *StmtLoop) error {
+	if stmt.keyword.Type == For {
+		f.forLoop(nil, stmt)
+		return nil
+	}
+	f.emit(While)
+	f.space()
+	f.emit(LeftParen)
+	f.expr(stmt.condition)
+	f.emit(RightParen)
+	f.body(stmt.body)
+	return nil
+}
+
+// The parser fills a missing condition with `true` so the clauses are told apart by the tokens
+func (f *Formatter) forLoop(initializer Stmt, loop *StmtLoop) {
+	f.emit(For)
+	f.space()
+	f.emit(LeftParen)
+	if initializer != nil {
+		f.stmt(initializer)
+	} else {
+		f.emit(Semicolon)
+	}
+	if f.peek().Type != Semicolon {
+		f.space()
+		f.expr(loop.condition)
+	}
+	f.emit(Semicolon)
+	if loop.increment != nil {
+		f.space()
+		f.expr(loop.increment)
+	}
+	f.emit(RightParen)
+	f.body(loop.body)
+}
+
+func (f *Formatter) visitExpressionStmt(stmt *StmtExpression) error {
+	f.expr(stmt.expression)
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitPrintStmt(stmt *StmtPrint) error {
+	f.emit(Print)
+	f.space()
+	f.expr(stmt.expression)
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitReturnStmt(stmt *StmtReturn) error {
+	f.emit(Return)
+	if stmt.expression != nil {
+		f.space()
+		f.expr(stmt.expression)
+	}
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitVarStmt(stmt *StmtVar) error {
+	f.emit(Var)
+	f.space()
+	f.emit(Identifier)
+	if stmt.initializer != nil {
+		f.space()
+		f.emit(Equal)
+		f.space()
+		f.expr(stmt.initializer)
+	}
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitBreakStmt(stmt *StmtBreak) error {
+	f.emit(Break)
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitContinueStmt(stmt *StmtContinue) error {
+	f.emit(Continue)
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitAssertStmt(stmt *StmtAssert) error {
+	f.emit(Identifier)
+	f.space()
+	f.expr(stmt.condition)
+	if stmt.message != nil {
+		f.emit(Comma)
+		f.space()
+		f.expr(stmt.message)
+	}
+	f.emit(Semicolon)
+	return nil
+}
+
+func (f *Formatter) visitTestStmt(stmt *StmtTest) error {
+	f.emit(Identifier)
+	f.space()
+	f.emit(String)
+	f.space()
+	return stmt.body.accept(f)
+}
+
+func (f *Formatter) visitAssignExpr(expr *ExprAssign) (any, error) {
+	f.emit(Identifier)
+	f.space()
+	f.emit(Equal)
+	f.space()
+	f.expr(expr.value)
+	return nil, nil
+}
+
+func (f *Formatter) visitBinaryExpr(expr *ExprBinary) (any, error) {
+	f.expr(expr.left)
+	if expr.operator.Type != Comma {
+		f.space()
+	}
+	f.emit(expr.operator.Type)
+	f.space()
+	f.expr(expr.right)
+	return nil, nil
+}
+
+func (f *Formatter) visitFunctionExpr(expr *ExprFunction) (any, error) {
+	f.emit(Fun)
+	f.space()
+	f.function(expr)
+	return nil, nil
+}
+
+func (f *Formatter) visitArrayExpr(expr *ExprArray) (any, error) {
+	f.expr(expr.array)
+	f.emit(LeftBracket)
+	f.expr(expr.index)
+	f.emit(RightBracket)
+	return nil, nil
+}
+
+func (f *Formatter) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
+	f.emit(Array)
+	f.emit(LeftBrace)
+	f.list(RightBrace, len(expr.arguments), func(i int) {
+		f.expr(expr.arguments[i])
+	})
+	return nil, nil
+}
+
+func (f *Formatter) visitCallExpr(expr *ExprCall) (any, error) {
+	f.expr(expr.callee)
+	f.emit(LeftParen)
+	f.list(RightParen, len(expr.arguments), func(i int) {
+		f.expr(expr.arguments[i])
+	})
+	return nil, nil
+}
+
+func (f *Formatter) visitGetExpr(expr *ExprGet) (any, error) {
+	f.expr(expr.object)
+	f.emit(Dot)
+	f.emit(Identifier)
+	return nil, nil
+}
+
+func (f *Formatter) visitTernaryExpr(expr *ExprTernary) (any, error) {
+	f.expr(expr.condition)
+	f.space()
+	f.emit(QuestionMark)
+	f.space()
+	f.expr(expr.left)
+	f.space()
+	f.emit(Colon)
+	f.space()
+	f.expr(expr.right)
+	return nil, nil
+}
+
+func (f *Formatter) visitGroupingExpr(expr *ExprGrouping) (any, error) {
+	f.emit(LeftParen)
+	f.expr(expr.expression)
+	f.emit(RightParen)
+	return nil, nil
+}
+
+// Literals keep their lexeme, `1.50` isn't rewritten as `1.5`
+func (f *Formatter) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	switch tokenType := f.peek().Type; tokenType {
+	case Number, String, True, False, Nil:
+		f.emit(tokenType)
+	default:
+		f.emit(Number)
+	}
+	return nil, nil
+}
+
+func (f *Formatter) visitLogicalExpr(expr *ExprLogical) (any, error) {
+	f.expr(expr.left)
+	f.space()
+	f.emit(expr.operator.Type)
+	f.space()
+	f.expr(expr.right)
+	return nil, nil
+}
+
+func (f *Formatter) visitSetExpr(expr *ExprSet) (any, error) {
+	f.expr(expr.object)
+	f.emit(Dot)
+	f.emit(Identifier)
+	f.space()
+	f.emit(Equal)
+	f.space()
+	f.expr(expr.value)
+	return nil, nil
+}
+
+func (f *Formatter) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
+	f.expr(expr.object)
+	f.emit(LeftBracket)
+	f.expr(expr.index)
+	f.emit(RightBracket)
+	f.space()
+	f.emit(Equal)
+	f.space()
+	f.expr(expr.value)
+	return nil, nil
+}
+
+func (f *Formatter) visitSuperExpr(expr *ExprSuper) (any, error) {
+	f.emit(Super)
+	f.emit(Dot)
+	f.emit(Identifier)
+	return nil, nil
+}
+
+func (f *Formatter) visitThisExpr(expr *ExprThis) (any, error) {
+	f.emit(This)
+	return nil, nil
+}
+
+func (f *Formatter) visitUnaryExpr(expr *ExprUnary) (any, error) {
+	f.emit(expr.operator.Type)
+	f.expr(expr.right)
+	return nil, nil
+}
+
+func (f *Formatter) visitVariableExpr(expr *ExprVariable) (any, error) {
+	f.emit(Identifier)
+	return nil, nil
+}
+
+// Comma separated items up to [closing], the opening token is already printed
+// When the items don't fit on the line each of them goes on its own line
+func (f *Formatter) list(closing TokenType, count int, item func(i int)) {
+	items := func(f *Formatter, isBroken bool) {
+		for i := range count {
+			if isBroken {
+				f.newline()
+			}
+			item(i)
+			if i < count-1 {
+				f.emit(Comma)
+				if !isBroken {
+					f.space()
+				}
+			}
+		}
+	}
+
+	isBroken := false
+	if count > 0 && !f.isMeasuring {
+		measure := f.measure(func() {
+			items(f, false)
+			f.emit(closing)
+		})
+		isBroken = f.column()+measure > formatMaxWidth
+	}
+
+	if !isBroken {
+		items(f, false)
+		f.emit(closing)
+		return
+	}
+	f.indent++
+	items(f, true)
+	f.indent--
+	f.newline()
+	f.emit(closing)
+}
+
+// Width of the first line [print] would write, the formatter state is restored afterwards
+func (f *Formatter) measure(print func()) int {
+	saved := *f
+	f.out = &strings.Builder{}
+	f.isMeasuring = true
+	f.pendingNewlines = 0
+	f.pendingSpace = false
+	print()
+	line, _, _ := strings.Cut(f.out.String(), "\n")
+	*f = saved
+	return len(line)
+}
+
+func (f *Formatter) column() int {
+	text := f.out.String()
+	column := len(text) - strings.LastIndexByte(text, '\n') - 1
+	if f.pendingSpace {
+		column++
+	}
+	return column
+}
+
+func (f *Formatter) tokenIndex(token *Token) int {
+	index := slices.Index(f.tokens, token)
+	if index < 0 {
+		panic(formatterError{"token '" + token.Lexeme + "' is not part of the source"})
+	}
+	return index
+}
+
+func (f *Formatter) peek() *Token {
+	return f.tokens[f.current]
+}
+
+// Consumes the next token, it must be of [tokenType]
+func (f *Formatter) next(tokenType TokenType) *Token {
+	token := f.peek()
+	if token.Type != tokenType {
+		panic(formatterError{fmt.Sprintf("expect %v at line %v but got '%v'", tokenType, token.Line, token.Lexeme)})
+	}
+	if token.Type != EOF {
+		f.current++
+	}
+	return token
+}
+
+// Prints the next token along with its comments
+func (f *Formatter) emit(tokenType TokenType) {
+	token := f.next(tokenType)
+	f.leadingTrivia(token)
+	f.write(token.Lexeme)
+	f.trailingTrivia(token)
+}
+
+// Comments on their own line stay on their own line, the others stay next to the code
+func (f *Formatter) leadingTrivia(token *Token) {
+	if f.isMeasuring {
+		return
+	}
+	// The token keeps the indentation the layout gave it even after comments
+	isLineStart := f.pendingNewlines > 0 && !f.isContinuation
+	hadComments := false
+	for _, trivia := range token.LeadingTrivia {
+		switch trivia.Kind {
+		case TriviaNewline:
+			f.sourceNewlines++
+		case TriviaLineComment, TriviaBlockComment:
+			if f.sourceNewlines > 0 || f.out.Len() == 0 {
+				f.newline()
+				f.keepBlankLine()
+			} else {
+				f.space()
+			}
+			f.comment(trivia)
+			hadComments = true
+		}
+	}
+	if hadComments && f.sourceNewlines > 0 {
+		f.pendingNewlines = max(f.pendingNewlines, 1)
+		f.isContinuation = !isLineStart
+	} else if hadComments && f.pendingNewlines > 0 {
+		f.isContinuation = !isLineStart
+	}
+	f.keepBlankLine()
+}
+
+func (f *Formatter) trailingTrivia(token *Token) {
+	f.sourceNewlines = 0
+	if f.isMeasuring {
+		return
+	}
+	for _, trivia := range token.TrailingTrivia {
+		switch trivia.Kind {
+		case TriviaNewline:
+			f.sourceNewlines++
+		case TriviaLineComment, TriviaBlockComment:
+			f.space()
+			f.comment(trivia)
+		}
+	}
+}
+
+func (f *Formatter) comment(trivia Trivia) {
+	f.write(trivia.Text)
+	f.sourceNewlines = 0
+	if trivia.Kind == TriviaLineComment {
+		// Nothing else can follow on the same line
+		f.pendingNewlines = max(f.pendingNewlines, 1)
+		f.isContinuation = true
+	} else {
+		f.space()
+	}
+}
+
+// A blank line of the source is kept where the layout breaks the line anyway
+func (f *Formatter) keepBlankLine() {
+	if f.sourceNewlines > 1 && f.pendingNewlines > 0 && !f.isBlockStart {
+		f.pendingNewlines = 2
+	}
+}
+
+func (f *Formatter) newline() {
+	f.pendingNewlines = max(f.pendingNewlines, 1)
+	f.isContinuation = false
+}
+
+func (f *Formatter) space() {
+	f.pendingSpace = true
+}
+
+func (f *Formatter) write(text string) {
+	if text == "" {
+		return
+	}
+	if f.pendingNewlines > 0 && f.out.Len() > 0 {
+		f.out.WriteString(strings.Repeat("\n", f.pendingNewlines))
+		indent := f.indent
+		if f.isContinuation {
+			indent++
+		}
+		f.out.WriteString(strings.Repeat(formatIndent, indent))
+	} else if f.pendingSpace && f.out.Len() > 0 {
+		f.out.WriteByte(' ')
+	}
+	f.pendingNewlines = 0
+	f.pendingSpace = false
+	f.isContinuation = false
+	f.isBlockStart = false
+	f.out.WriteString(text)
+}
+
+func hasComments(trivia []Trivia) bool {
+	for _, t := range trivia {
+		if t.Kind == TriviaLineComment || t.Kind == TriviaBlockComment {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,28 @@ package main
 
 import "fmt"
 
+// Names of the scopes declared by classes, see [Environment.names]
+var (
+	thisScopeNames  = []string{"this"}
+	superScopeNames = []string{"super"}
+)
+
+// The name, or the `fun` keyword for anonymous functions which have none
+func (stmt *StmtFunction) firstToken() *Token {
+	if stmt.name == nil {
+		return stmt.function.keyword
+	}
+	return stmt.name
+}
+
 type Function struct {
 	declaration   *StmtFunction
 	closure       *Environment
 	isInitializer bool
+	// Class declaring the method, empty for functions
+	className string
+	// `name:line` in the profiles, made on the first profiled call
+	profileLabel string
 }
 
 func NewFunction(declaration *StmtFunction, closure *Environment, isInitializer bool) *Function {
@@ -16,12 +34,48 @@ func NewFunction(declaration *StmtFunction, closure *Environment, isInitializer
 	}
 }
 
+func (f *Function) WithClassName(className string) *Function {
+	f.className = className
+	return f
+}
+
+// Name shown in call stacks and profiles, methods are prefixed by their class
+func (f *Function) name() string {
+	name := "<fn>"
+	if f.declaration.name != nil {
+		name = f.declaration.name.Lexeme
+	}
+	if f.className != "" {
+		return f.className + "." + name
+	}
+	return name
+}
+
+// Line of the name, or of the `fun` keyword for anonymous functions
+func (f *Function) line() int {
+	return f.declaration.firstToken().Line
+}
+
 func (f *Function) arity() int {
 	return len(f.declaration.function.params)
 }
 
 func (f *Function) call(interpreter *Interpreter, arguments []any) (any, error) {
 	env := NewEnvironment().WithEnclosing(f.closure)
+	if interpreter.scopeNames != nil {
+		env.WithNames(interpreter.scopeNames[f.declaration.function])
+	}
+	if interpreter.debugger != nil {
+		interpreter.debugger.enterCall(f)
+		defer interpreter.debugger.exitCall()
+	}
+	if interpreter.profiler != nil {
+		if f.profileLabel == "" {
+			f.profileLabel = fmt.Sprintf("%v:%d", f.name(), f.line())
+		}
+		interpreter.profiler.enter(f.profileLabel)
+		defer interpreter.profiler.exit()
+	}
 
 	for i := range f.declaration.function.params {
 		env.define(arguments[i])
@@ -47,10 +101,12 @@ func (f *Function) call(interpreter *Interpreter, arguments []any) (any, error)
 }
 
 func (f *Function) Bind(instance *LoxInstance) *Function {
-	env := NewEnvironment().WithEnclosing(f.closure)
+	env := NewEnvironment().WithEnclosing(f.closure).WithNames(thisScopeNames)
 	// The first element of the array will always be `this` for object methods
 	env.define(instance)
-	return NewFunction(f.declaration, env, f.isInitializer)
+	bound := NewFunction(f.declaration, env, f.isInitializer).WithClassName(f.className)
+	bound.profileLabel = f.profileLabel
+	return bound
 }
 
 func (f *Function) IsGetter() bool {
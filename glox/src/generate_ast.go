@@ -0,0 +1,272 @@
+//go:build ignore
+
+// Generates the syntax tree nodes like GenerateAst in the book: expr.go and stmt.go with the structs,
+// constructors and visitors, and ast_children.go used by the walker and the rewriter.
+// Run `go generate` after editing the specs below
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+type nodeSpec struct {
+	name string
+	// Constructor parameters as in the book, e.g. `Expr left, Token operator, Expr right`
+	fields string
+	// Fields set by `WithX` builders rather than the constructor
+	builders string
+	// Comments of the fields
+	docs map[string]string
+	// Field returned by `firstToken()`, statements only, the other ones write it by hand
+	first string
+}
+
+const (
+	sourceDoc    = "Text of the `///` or `/** */` comment right above, only kept when scanning losslessly"
+	semicolonDoc = "The `;` ending the statement, `nil` for statements made up by the interpreter"
+)
+
+var exprSpecs = []nodeSpec{
+	{name: "Assign", fields: "Token name, Expr value"},
+	{name: "Binary", fields: "Expr left, Token operator, Expr right"},
+	{name: "Function", fields: "List<Token> params, List<Stmt> body", builders: "Token keyword, Token end",
+		docs: map[string]string{
+			"keyword": "The `fun` keyword of anonymous functions, `nil` for the declared ones",
+			"end":     "The closing brace of the body",
+		}},
+	{name: "Array", fields: "Expr array, Token bracket, Expr index", builders: "Token end",
+		docs: map[string]string{"end": "The closing bracket"}},
+	{name: "ArrayInstance", fields: "List<Expr> arguments", builders: "Token keyword, Token end",
+		docs: map[string]string{
+			"keyword": "The `Array` keyword, `nil` for arrays made up by the interpreter",
+			"end":     "The closing brace, `nil` for arrays made up by the interpreter",
+		}},
+	{name: "Call", fields: "Expr callee, Token paren, List<Expr> arguments"},
+	{name: "Get", fields: "Expr object, Token name"},
+	{name: "Ternary", fields: "Token operator, Expr condition, Expr left, Expr right"},
+	{name: "Grouping", fields: "Expr expression", builders: "Token paren, Token end",
+		docs: map[string]string{
+			"paren": "The opening parenthesis, `nil` for groupings made up by the interpreter",
+			"end":   "The closing parenthesis, `nil` for groupings made up by the interpreter",
+		}},
+	{name: "Literal", fields: "Object value", builders: "Token token, Boolean fresh",
+		docs: map[string]string{
+			"token": "`nil` for literals made up by the parser or the optimizer, e.g. the condition of `for (;;)`",
+			"fresh": "Strings folded by the optimizer are copied on each evaluation, like the concatenation they replace",
+		}},
+	{name: "Logical", fields: "Expr left, Token operator, Expr right"},
+	{name: "Set", fields: "Expr object, Token name, Expr value"},
+	{name: "SetArray", fields: "Token name, Expr object, Expr index, Expr value"},
+	{name: "Super", fields: "Token keyword, Token method"},
+	{name: "This", fields: "Token keyword"},
+	{name: "Unary", fields: "Token operator, Expr right"},
+	{name: "Variable", fields: "Token name"},
+}
+
+var stmtSpecs = []nodeSpec{
+	{name: "Block", fields: "Token brace, List<Stmt> block", builders: "Token end",
+		docs: map[string]string{"end": "The closing brace, `nil` for the block scoping the initializer of a `for`"}, first: "brace"},
+	{name: "Class", fields: "Token name, ExprVariable superclass, List<StmtFunction> methods, List<StmtFunction> staticMethods",
+		builders: "String doc, Token keyword, Token end",
+		docs: map[string]string{
+			"doc":     sourceDoc,
+			"keyword": "The `class` keyword",
+			"end":     "The closing brace of the body",
+		}, first: "name"},
+	// `firstToken()` is in function.go, anonymous functions have no name
+	{name: "Function", fields: "Token name, ExprFunction function", builders: "String doc, Token keyword",
+		docs: map[string]string{
+			"doc":     sourceDoc,
+			"keyword": "The `fun` keyword, or `class` for static methods, `nil` for the other methods",
+		}},
+	{name: "If", fields: "Token keyword, Expr condition, Stmt thenBranch, Stmt elseBranch", first: "keyword"},
+	{name: "Expression", fields: "Token first, Expr expression", builders: "Token end",
+		docs: map[string]string{"end": semicolonDoc}, first: "first"},
+	{name: "Print", fields: "Token keyword, Expr expression", builders: "Token end",
+		docs: map[string]string{"end": semicolonDoc}, first: "keyword"},
+	{name: "Return", fields: "Token keyword, Expr expression", builders: "Token end",
+		docs: map[string]string{"end": semicolonDoc}, first: "keyword"},
+	{name: "Var", fields: "Token name, Expr initializer", builders: "Token keyword, Token end",
+		docs: map[string]string{"keyword": "The `var` keyword", "end": semicolonDoc}, first: "name"},
+	{name: "Loop", fields: "Token keyword, Expr condition, Expr increment, Stmt body", first: "keyword"},
+	{name: "Break", fields: "Token keyword", builders: "Token end", docs: map[string]string{"end": semicolonDoc}, first: "keyword"},
+	{name: "Continue", fields: "Token keyword", builders: "Token end", docs: map[string]string{"end": semicolonDoc}, first: "keyword"},
+	{name: "Assert", fields: "Token keyword, Expr condition, Expr message", builders: "Token end",
+		docs: map[string]string{"message": "`nil` when the assertion has no message", "end": semicolonDoc}, first: "keyword"},
+	{name: "Test", fields: "Token keyword, Token name, StmtBlock body", first: "keyword"},
+}
+
+type field struct {
+	name     string
+	specType string
+	goType   string
+}
+
+func parseFields(fields string) []field {
+	parsed := []field{}
+	if fields == "" {
+		return parsed
+	}
+	for _, part := range strings.Split(fields, ",") {
+		specType, name, ok := strings.Cut(strings.TrimSpace(part), " ")
+		if !ok {
+			log.Fatalf("invalid field %q", part)
+		}
+		parsed = append(parsed, field{name: name, specType: specType, goType: goType(specType)})
+	}
+	return parsed
+}
+
+func goType(specType string) string {
+	if inner, ok := strings.CutPrefix(specType, "List<"); ok {
+		return "[]" + goType(strings.TrimSuffix(inner, ">"))
+	}
+	switch specType {
+	case "Expr", "Stmt":
+		return specType
+	case "Object":
+		return "any"
+	case "String":
+		return "string"
+	case "Boolean":
+		return "bool"
+	}
+	return "*" + specType
+}
+
+// Fields holding other nodes, the tokens and values aren't children
+func isChild(goType string) bool {
+	goType = strings.TrimLeft(goType, "[]*")
+	return strings.HasPrefix(goType, "Expr") || strings.HasPrefix(goType, "Stmt")
+}
+
+const header = "// Code generated by generate_ast.go. DO NOT EDIT.\n\npackage main\n"
+
+func defineAst(base string, specs []nodeSpec) string {
+	receiver := strings.ToLower(base)
+	var builder strings.Builder
+	builder.WriteString(header)
+
+	fmt.Fprintf(&builder, "\ntype %v interface {\n", base)
+	if base == "Stmt" {
+		fmt.Fprintf(&builder, "accept(%vVisitor) error\n", base)
+		builder.WriteString("// Token where the statement starts, used to report the line being executed\nfirstToken() *Token\n")
+	} else {
+		fmt.Fprintf(&builder, "accept(%vVisitor) (any, error)\n", base)
+	}
+	builder.WriteString("}\n")
+
+	result := "(any, error)"
+	if base == "Stmt" {
+		result = "error"
+	}
+	fmt.Fprintf(&builder, "\ntype %vVisitor interface {\n", base)
+	for _, spec := range specs {
+		fmt.Fprintf(&builder, "visit%v%v(*%v%v) %v\n", spec.name, base, base, spec.name, result)
+	}
+	builder.WriteString("}\n")
+
+	for _, spec := range specs {
+		typeName := base + spec.name
+		fields := parseFields(spec.fields)
+		builders := parseFields(spec.builders)
+
+		fmt.Fprintf(&builder, "\n// %v : %v\ntype %v struct {\n", spec.name, spec.fields, typeName)
+		for _, field := range append(append([]field{}, fields...), builders...) {
+			if doc, ok := spec.docs[field.name]; ok {
+				fmt.Fprintf(&builder, "// %v\n", doc)
+			}
+			fmt.Fprintf(&builder, "%v %v\n", field.name, field.goType)
+		}
+		builder.WriteString("}\n")
+
+		params := []string{}
+		for _, field := range fields {
+			params = append(params, field.name+" "+field.goType)
+		}
+		fmt.Fprintf(&builder, "\nfunc New%v(%v) *%v {\nreturn &%v{\n", typeName, strings.Join(params, ", "), typeName, typeName)
+		for _, field := range fields {
+			fmt.Fprintf(&builder, "%v: %v,\n", field.name, field.name)
+		}
+		builder.WriteString("}\n}\n")
+
+		for _, field := range builders {
+			method := "With" + strings.ToUpper(field.name[:1]) + field.name[1:]
+			fmt.Fprintf(&builder, "\nfunc (%v *%v) %v(%v %v) *%v {\n%v.%v = %v\nreturn %v\n}\n",
+				receiver, typeName, method, field.name, field.goType, typeName, receiver, field.name, field.name, receiver)
+		}
+
+		fmt.Fprintf(&builder, "\nfunc (%v *%v) accept(v %vVisitor) %v {\nreturn v.visit%v%v(%v)\n}\n",
+			receiver, typeName, base, result, spec.name, base, receiver)
+
+		if spec.first != "" {
+			fmt.Fprintf(&builder, "\nfunc (%v *%v) firstToken() *Token {\nreturn %v.%v\n}\n", receiver, typeName, receiver, spec.first)
+		}
+	}
+	return builder.String()
+}
+
+// The type switches walking and rewriting the children of any node
+func defineChildren() string {
+	var walk, rewrite strings.Builder
+	for _, group := range []struct {
+		base  string
+		specs []nodeSpec
+	}{{"Expr", exprSpecs}, {"Stmt", stmtSpecs}} {
+		for _, spec := range group.specs {
+			children := []field{}
+			for _, field := range parseFields(spec.fields) {
+				if isChild(field.goType) {
+					children = append(children, field)
+				}
+			}
+			if len(children) == 0 {
+				continue
+			}
+			fmt.Fprintf(&walk, "case *%v%v:\n", group.base, spec.name)
+			fmt.Fprintf(&rewrite, "case *%v%v:\n", group.base, spec.name)
+			for _, child := range children {
+				if element, ok := strings.CutPrefix(child.goType, "[]"); ok {
+					fmt.Fprintf(&walk, "for _, child := range node.%v {\nvisit(child)\n}\n", child.name)
+					fmt.Fprintf(&rewrite, "for i, child := range node.%v {\nnode.%v[i] = rewrite(child).(%v)\n}\n", child.name, child.name, element)
+					continue
+				}
+				fmt.Fprintf(&walk, "if node.%v != nil {\nvisit(node.%v)\n}\n", child.name, child.name)
+				fmt.Fprintf(&rewrite, "if node.%v != nil {\nnode.%v = rewrite(node.%v).(%v)\n}\n", child.name, child.name, child.name, child.goType)
+			}
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(header)
+	builder.WriteString("\n// Calls [visit] on the Stmt and Expr children of [node] in source order, `nil` ones are skipped\n")
+	builder.WriteString("func walkChildren(node any, visit func(child any)) {\nswitch node := node.(type) {\n")
+	builder.WriteString(walk.String())
+	builder.WriteString("}\n}\n")
+	builder.WriteString("\n// Replaces the Stmt and Expr children of [node] by what [rewrite] returns for them\n")
+	builder.WriteString("func rewriteChildren(node any, rewrite func(child any) any) {\nswitch node := node.(type) {\n")
+	builder.WriteString(rewrite.String())
+	builder.WriteString("}\n}\n")
+	return builder.String()
+}
+
+func writeSource(path, source string) {
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		log.Fatalf("%v: %v\n%v", path, err, source)
+	}
+	err = os.WriteFile(path, formatted, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	writeSource("expr.go", defineAst("Expr", exprSpecs))
+	writeSource("stmt.go", defineAst("Stmt", stmtSpecs))
+	writeSource("ast_children.go", defineChildren())
+}
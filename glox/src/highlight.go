@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+)
+
+// Classes of highlighted text, HTML output prefixes them with `lox-`
+const (
+	highlightKeyword    = "keyword"
+	highlightConstant   = "constant"
+	highlightString     = "string"
+	highlightNumber     = "number"
+	highlightDefinition = "definition"
+	highlightOperator   = "operator"
+	highlightComment    = "comment"
+	highlightError      = "error"
+)
+
+var highlightColors = map[string]string{
+	highlightKeyword:    "\x1b[35m",
+	highlightConstant:   "\x1b[33m",
+	highlightString:     "\x1b[32m",
+	highlightNumber:     "\x1b[36m",
+	highlightDefinition: "\x1b[1;34m",
+	highlightOperator:   "\x1b[37m",
+	highlightComment:    "\x1b[90m",
+	highlightError:      "\x1b[4;31m",
+}
+
+const ansiReset = "\x1b[0m"
+
+func highlightCommand(args []string) error {
+	flags := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox highlight [flags] [script]")
+		fmt.Fprintln(os.Stderr, "Prints the script, or the standard input, with syntax highlighting")
+		fmt.Fprintln(os.Stderr, "The HTML fragment uses the classes lox-keyword, lox-constant, lox-string, lox-number,")
+		fmt.Fprintln(os.Stderr, "lox-definition, lox-operator, lox-comment and lox-error")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "ansi", "output `format`: ansi for terminals or html")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if *format != "ansi" && *format != "html" {
+		return fmt.Errorf("Unknown format '%v', expect ansi or html.", *format)
+	}
+
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var source []byte
+	if flags.NArg() == 0 {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(highlight(string(source), &GlobalConfig, *format))
+	return nil
+}
+
+// Highlights from the tokens of the lossless scanner so the keywords follow the features enabled,
+// the source is kept as is even when it doesn't scan
+func highlight(source string, base *Config, format string) string {
+	reporter := NewErrorReporter(io.Discard)
+	config := SourceConfig(source, base, reporter)
+	scanner := NewScanner(source, config, reporter).WithLossless()
+	// Errors only affect the unscannable text, kept as skipped trivia
+	scanner.scanTokens()
+
+	var builder strings.Builder
+	write := func(class, text string) {
+		switch {
+		case format == "html" && class != "":
+			fmt.Fprintf(&builder, "<span class=\"lox-%v\">%v</span>", class, html.EscapeString(text))
+		case format == "html":
+			builder.WriteString(html.EscapeString(text))
+		case class != "":
+			builder.WriteString(highlightColors[class] + text + ansiReset)
+		default:
+			builder.WriteString(text)
+		}
+	}
+	writeTrivia := func(trivia []Trivia) {
+		for _, trivia := range trivia {
+			switch trivia.Kind {
+			case TriviaLineComment, TriviaBlockComment:
+				write(highlightComment, trivia.Text)
+			case TriviaSkipped:
+				write(highlightError, trivia.Text)
+			default:
+				write("", trivia.Text)
+			}
+		}
+	}
+
+	if format == "html" {
+		builder.WriteString("<pre class=\"lox\"><code>")
+	}
+	for i, token := range scanner.Tokens {
+		writeTrivia(token.LeadingTrivia)
+		write(highlightClass(scanner.Tokens, i), token.Lexeme)
+		writeTrivia(token.TrailingTrivia)
+	}
+	if format == "html" {
+		builder.WriteString("</code></pre>\n")
+	}
+	return builder.String()
+}
+
+// Names following `fun` and `class` are the ones declared, the one after `class Name <` is inherited
+func highlightClass(tokens []*Token, i int) string {
+	isAfter := func(types ...TokenType) bool {
+		if i < len(types) {
+			return false
+		}
+		for j, tokenType := range types {
+			if tokens[i-len(types)+j].Type != tokenType {
+				return false
+			}
+		}
+		return true
+	}
+	switch tokens[i].Type {
+	case True, False, Nil, This, Super:
+		return highlightConstant
+	case And, Class, Else, Fun, For, If, Or, Print, Return, Var, While, Break, Continue, Array:
+		return highlightKeyword
+	case String:
+		return highlightString
+	case Number:
+		return highlightNumber
+	case Identifier:
+		if isAfter(Fun) || isAfter(Class) || isAfter(Class, Identifier, Less) {
+			return highlightDefinition
+		}
+		return ""
+	case EOF, LeftParen, RightParen, LeftBrace, RightBrace, LeftBracket, RightBracket, Comma, Dot, Semicolon:
+		return ""
+	}
+	return highlightOperator
+}
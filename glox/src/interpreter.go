@@ -2,17 +2,26 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type RuntimeError struct {
 	token   *Token
 	message string
+	// Lines explaining the error, e.g. the values of a failed assertion
+	details []string
 }
 
 func (e *RuntimeError) Error() string {
+	if len(e.details) > 0 {
+		return fmt.Sprintf("%v\n    %v\n[line %v]", e.message, strings.Join(e.details, "\n    "), e.token.Line)
+	}
 	return fmt.Sprintf("%v\n[line %v]", e.message, e.token.Line)
 }
 
@@ -23,10 +32,34 @@ func NewRuntimeError(token *Token, message string) *RuntimeError {
 	}
 }
 
+func (e *RuntimeError) WithDetails(details []string) *RuntimeError {
+	e.details = details
+	return e
+}
+
 type Interpreter struct {
 	enviroment *Environment
 	globals    map[string]any
 	locals     map[Expr]*Position
+	config     *Config
+	stdout     io.Writer
+	stderr     io.Writer
+	// Set from another goroutine (e.g. on SIGINT) to abort the running statement
+	interrupted atomic.Bool
+	// Pauses the execution between statements, `nil` unless debugging
+	debugger *Debugger
+	// Lets the other clients of a shared REPL session run between statements, `nil` otherwise
+	yield func()
+	// Variable names of the blocks and functions by slot, only kept while debugging
+	scopeNames map[any][]string
+	// Times the Lox calls, `nil` unless profiling
+	profiler *Profiler
+	// Counts the statements and branches executed, `nil` unless measuring the coverage
+	coverage *Coverage
+	// Records or replays the results of the natives reading the outside world, `nil` to call them
+	inputs InputSource
+	// Values of the expressions evaluated by the running assertion, `nil` outside of assertions
+	assertValues map[Expr]any
 }
 
 type Position struct {
@@ -42,7 +75,7 @@ func NewInterpreter() *Interpreter {
 				return float64(time.Now().Unix()), nil
 			},
 			func() string { return "<native fn>" },
-		),
+		).WithName("clock").WithInput(),
 		"len": NewProtoCallable(
 			func() int { return 1 },
 			func(interpreter *Interpreter, arguments []any) (any, error) {
@@ -59,16 +92,27 @@ func NewInterpreter() *Interpreter {
 				}
 			},
 			func() string { return "<native fn>" },
-		),
+		).WithName("len"),
 	}
 
+	// Copied so the session can toggle features without affecting the others
+	config := GlobalConfig
 	return &Interpreter{
 		globals:    globals,
 		enviroment: NewEnvironment(),
 		locals:     map[Expr]*Position{},
+		config:     &config,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
 	}
 }
 
+func (i *Interpreter) WithOutput(stdout, stderr io.Writer) *Interpreter {
+	i.stdout = stdout
+	i.stderr = stderr
+	return i
+}
+
 func (i *Interpreter) interpret(stmts []Stmt) error {
 	for _, stmt := range stmts {
 		err := i.execute(stmt)
@@ -80,19 +124,66 @@ func (i *Interpreter) interpret(stmts []Stmt) error {
 }
 
 func (i *Interpreter) evaluate(expr Expr) (any, error) {
-	return expr.accept(i)
+	value, err := expr.accept(i)
+	if i.assertValues != nil && err == nil {
+		i.assertValues[expr] = value
+	}
+	return value, err
 }
 
 func (i *Interpreter) resolve(expr Expr, depth int, index int) {
 	i.locals[expr] = &Position{depth, index}
 }
 
+// [node] is the block or function owning the scope
+func (i *Interpreter) resolveScope(node any, names []string) {
+	if i.scopeNames != nil {
+		i.scopeNames[node] = names
+	}
+}
+
 func (i *Interpreter) execute(stmt Stmt) error {
+	if i.yield != nil {
+		i.yield()
+	}
+	if i.interrupted.Load() {
+		return NewRuntimeError(stmt.firstToken(), "Interrupted")
+	}
+	if i.debugger != nil {
+		err := i.debugger.beforeStatement(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	if i.coverage != nil {
+		i.coverage.hitStatement(stmt)
+	}
+	if i.profiler != nil {
+		i.profiler.line(stmt.firstToken().Line)
+	}
 	return stmt.accept(i)
 }
 
+// Safe to call while the interpreter is running, it stops at the next statement
+// The flag stays set until [Interpreter.ClearInterrupt] so no caller can swallow it
+func (i *Interpreter) Interrupt() {
+	i.interrupted.Store(true)
+}
+
+func (i *Interpreter) ClearInterrupt() {
+	i.interrupted.Store(false)
+}
+
+func (i *Interpreter) IsInterrupted() bool {
+	return i.interrupted.Load()
+}
+
 func (interpreter *Interpreter) visitBlockStmt(stmt *StmtBlock) error {
-	return interpreter.executeBlock(stmt.block, NewEnvironment().WithEnclosing(interpreter.enviroment))
+	env := NewEnvironment().WithEnclosing(interpreter.enviroment)
+	if interpreter.scopeNames != nil {
+		env.WithNames(interpreter.scopeNames[stmt])
+	}
+	return interpreter.executeBlock(stmt.block, env)
 }
 
 func (interpreter *Interpreter) visitClassStmt(stmt *StmtClass) error {
@@ -117,7 +208,7 @@ func (interpreter *Interpreter) visitClassStmt(stmt *StmtClass) error {
 	}
 
 	if stmt.superclass != nil {
-		interpreter.enviroment = NewEnvironment().WithEnclosing(interpreter.enviroment)
+		interpreter.enviroment = NewEnvironment().WithEnclosing(interpreter.enviroment).WithNames(superScopeNames)
 		interpreter.enviroment.define("super")
 		interpreter.enviroment.assignAtLast(superclass)
 	}
@@ -128,12 +219,12 @@ func (interpreter *Interpreter) visitClassStmt(stmt *StmtClass) error {
 		if method.name.Lexeme == "init" {
 			isInitializer = true
 		}
-		methods[method.name.Lexeme] = NewFunction(method, interpreter.enviroment, isInitializer)
+		methods[method.name.Lexeme] = NewFunction(method, interpreter.enviroment, isInitializer).WithClassName(stmt.name.Lexeme)
 	}
 
 	staticMethods := map[string]*Function{}
 	for _, staticMethod := range stmt.staticMethods {
-		staticMethods[staticMethod.name.Lexeme] = NewFunction(staticMethod, interpreter.enviroment, false)
+		staticMethods[staticMethod.name.Lexeme] = NewFunction(staticMethod, interpreter.enviroment, false).WithClassName(stmt.name.Lexeme)
 	}
 
 	class := NewLoxClass(
@@ -241,6 +332,9 @@ func (interpreter *Interpreter) visitIfStmt(stmt *StmtIf) (err error) {
 		return err
 	}
 
+	if interpreter.coverage != nil {
+		interpreter.coverage.hitBranch(stmt, branchIndex(isTruthy(eval)))
+	}
 	if isTruthy(eval) {
 		return interpreter.execute(stmt.thenBranch)
 	}
@@ -251,7 +345,7 @@ func (interpreter *Interpreter) visitIfStmt(stmt *StmtIf) (err error) {
 }
 
 func (interpreter *Interpreter) visitLoopStmt(stmt *StmtLoop) (err error) {
-	for eval, err := interpreter.evaluate(stmt.condition); isTruthy(eval); eval, err = interpreter.evaluate(stmt.condition) {
+	for eval, err := interpreter.evaluateLoopClause(stmt, stmt.condition); isTruthy(eval); eval, err = interpreter.evaluateLoopClause(stmt, stmt.condition) {
 		if err != nil {
 			return err
 		}
@@ -263,7 +357,7 @@ func (interpreter *Interpreter) visitLoopStmt(stmt *StmtLoop) (err error) {
 				return nil
 			case *ContinueShortCircuit:
 				if stmt.increment != nil {
-					_, err = interpreter.evaluate(stmt.increment)
+					_, err = interpreter.evaluateLoopClause(stmt, stmt.increment)
 					if err != nil {
 						return err
 					}
@@ -273,7 +367,7 @@ func (interpreter *Interpreter) visitLoopStmt(stmt *StmtLoop) (err error) {
 			return err
 		}
 		if stmt.increment != nil {
-			_, err = interpreter.evaluate(stmt.increment)
+			_, err = interpreter.evaluateLoopClause(stmt, stmt.increment)
 			if err != nil {
 				return err
 			}
@@ -282,13 +376,21 @@ func (interpreter *Interpreter) visitLoopStmt(stmt *StmtLoop) (err error) {
 	return nil
 }
 
+// The condition and the increment are profiled on the line of the loop rather than of the last statement run
+func (interpreter *Interpreter) evaluateLoopClause(stmt *StmtLoop, clause Expr) (any, error) {
+	if interpreter.profiler != nil {
+		interpreter.profiler.line(stmt.keyword.Line)
+	}
+	return interpreter.evaluate(clause)
+}
+
 func (interpreter *Interpreter) visitPrintStmt(stmt *StmtPrint) error {
 	v, err := interpreter.evaluate(stmt.expression)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(string(stringify(v)))
+	fmt.Fprintln(interpreter.stdout, string(stringify(v)))
 	return nil
 }
 
@@ -368,17 +470,21 @@ func (interpreter *Interpreter) visitBinaryExpr(expr *ExprBinary) (any, error) {
 		if err != nil {
 			return nil, err
 		}
-		return float64(int(math.Round(left.(float64))) % int(math.Round(right.(float64)))), nil
+		divisor := int(math.Round(right.(float64)))
+		if divisor == 0 {
+			return nil, NewRuntimeError(expr.operator, "Division by 0.")
+		}
+		return float64(int(math.Round(left.(float64))) % divisor), nil
 	case Plus:
 		if err := checkNumberOperands(expr.operator, left, right); err == nil {
 			return left.(float64) + right.(float64), nil
 		}
 		isLeftString, isRightString := isOfType[[]byte](left), isOfType[[]byte](right)
 		if (isLeftString && isRightString) ||
-			(GlobalConfig.AllowImplicitStringCast && (isLeftString || isRightString)) {
+			(interpreter.config.AllowImplicitStringCast && (isLeftString || isRightString)) {
 			return append(stringify(left), stringify(right)...), nil
 		}
-		if GlobalConfig.AllowImplicitStringCast {
+		if interpreter.config.AllowImplicitStringCast {
 			return nil, NewRuntimeError(expr.operator, "Operands must be numbers and/or strings.")
 		}
 		return nil, NewRuntimeError(expr.operator, "Operands must be two numbers or two strings.")
@@ -453,6 +559,12 @@ func (interpreter *Interpreter) visitCallExpr(expr *ExprCall) (any, error) {
 	}
 
 	result, err := function.call(interpreter, arguments)
+	if _, isNative := function.(*ProtoCallable); isNative && err != nil {
+		// Natives report plain errors, e.g. a diverging replay, they are located at the call
+		if _, ok := err.(*RuntimeError); !ok {
+			err = NewRuntimeError(expr.paren, err.Error())
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -478,7 +590,7 @@ func (interpreter *Interpreter) visitGetExpr(expr *ExprGet) (any, error) {
 		return method, nil
 	}
 
-	if GlobalConfig.AllowStaticMethods {
+	if interpreter.config.AllowStaticMethods {
 		if class, ok := object.(*LoxClass); ok {
 			return class.metaclass.Get(expr.name)
 		}
@@ -505,6 +617,9 @@ func (interpreter *Interpreter) visitTernaryExpr(expr *ExprTernary) (any, error)
 	if !ok {
 		return nil, NewRuntimeError(expr.operator, "Condition must evaluate to boolean.")
 	}
+	if interpreter.coverage != nil {
+		interpreter.coverage.hitBranch(expr, branchIndex(conditionBool))
+	}
 	if conditionBool {
 		return left, nil
 	}
@@ -517,11 +632,12 @@ func (interpreter *Interpreter) visitLogicalExpr(expr *ExprLogical) (any, error)
 		return nil, err
 	}
 
-	if expr.operator.Type == And {
-		if !isTruthy(left) {
-			return left, nil
-		}
-	} else if isTruthy(left) { // Logical `Or`
+	// Logical `Or` short-circuits on truthy values
+	isShortCircuit := isTruthy(left) != (expr.operator.Type == And)
+	if interpreter.coverage != nil {
+		interpreter.coverage.hitBranch(expr, branchIndex(!isShortCircuit))
+	}
+	if isShortCircuit {
 		return left, nil
 	}
 
@@ -533,6 +649,9 @@ func (interpreter *Interpreter) visitGroupingExpr(expr *ExprGrouping) (any, erro
 }
 
 func (interpreter *Interpreter) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	if expr.fresh {
+		return stringify(expr.value), nil
+	}
 	return expr.value, nil
 }
 
@@ -543,7 +662,7 @@ func (interpreter *Interpreter) visitSetExpr(expr *ExprSet) (any, error) {
 	}
 
 	if !isOfType[*LoxInstance](object) &&
-		(!GlobalConfig.AllowStaticMethods || !isOfType[*LoxClass](object)) {
+		(!interpreter.config.AllowStaticMethods || !isOfType[*LoxClass](object)) {
 		return nil, NewRuntimeError(expr.name, "Only instances have fields.")
 	}
 
@@ -567,8 +686,8 @@ func (interpreter *Interpreter) visitSetArrayExpr(expr *ExprSetArray) (any, erro
 	}
 
 	if !isOfType[*LoxInstance](object) &&
-		!(GlobalConfig.AllowStaticMethods || isOfType[*LoxClass](object)) &&
-		!(GlobalConfig.AllowArrays || isOfType[[]byte](object)) {
+		!(interpreter.config.AllowStaticMethods || isOfType[*LoxClass](object)) &&
+		!(interpreter.config.AllowArrays || isOfType[[]byte](object)) {
 		return nil, NewRuntimeError(expr.name, "Only instances have fields.")
 	}
 
@@ -666,7 +785,7 @@ func (interpreter *Interpreter) lookUpVariable(name *Token, expr Expr) (any, err
 		return nil, NewRuntimeError(name, "Undefined variable '"+name.Lexeme+"'.")
 	}
 	if isOfType[Uninitialized](value) {
-		if GlobalConfig.ForbidUninitializedVariable {
+		if interpreter.config.ForbidUninitializedVariable {
 			return nil, NewRuntimeError(name, "Uninitialized variable '"+name.Lexeme+"'.")
 		} else {
 			return nil, nil
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Returned by `glox lint` when a rule is broken, the findings are already printed
+var errLintFindings = errors.New("lint findings")
+
+// Comma separated lint rules, the flag can be repeated
+type ruleList []string
+
+func (l *ruleList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *ruleList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := FindLintRule(name); err != nil {
+			return err
+		}
+		*l = append(*l, name)
+	}
+	return nil
+}
+
+func lintCommand(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox lint [flags] <path> [path ...]")
+		fmt.Fprintln(os.Stderr, "Checks the scripts, or the .lox files in the directories, use --list to show the rules")
+		flags.PrintDefaults()
+	}
+	var only, skip ruleList
+	flags.Var(&only, "rules", "check only the comma separated `rules`")
+	flags.Var(&skip, "skip", "don't check the comma separated `rules`")
+	list := flags.Bool("list", false, "list the rules and exit")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		for _, rule := range LintRules {
+			fmt.Printf("%-20v %v\n", rule.Name, rule.Description)
+		}
+		return nil
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	files, err := loxFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		var out bytes.Buffer
+		fileErr := lintFile(file, &out, only, skip)
+		// Diagnostics are grouped by file when there are many of them
+		if out.Len() > 0 && len(files) > 1 {
+			fmt.Fprintf(os.Stderr, "%v:\n", file)
+		}
+		os.Stderr.Write(out.Bytes())
+		if fileErr != nil && (err == nil || errors.Is(err, errLintFindings)) {
+			err = fileErr
+		}
+	}
+	return err
+}
+
+func lintFile(filePath string, out *bytes.Buffer, only, skip []string) error {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	err = setupConfig(filePath)
+	if err != nil {
+		return err
+	}
+
+	reporter := NewErrorReporter(out)
+	config := SourceConfig(string(source), &GlobalConfig, reporter)
+	stmts, tokens, err := parseSource(string(source), config, reporter, false, false)
+	if err != nil {
+		return err
+	}
+	// The compiler checks come first, linting code that doesn't compile is pointless, but their warnings
+	// mustn't stop the rules so they are only shown
+	resolverConfig := *config
+	if resolverConfig.Warnings == WarningsAsErrors {
+		resolverConfig.Warnings = WarningsShown
+	}
+	NewResolver(NewInterpreter(), &resolverConfig, reporter).resolveStmts(stmts)
+	if reporter.hadError {
+		return NewParserError(tokens[len(tokens)-1], "Can't continue due to previous errors.")
+	}
+
+	linter := NewLinter(reporter)
+	if len(only) > 0 {
+		for _, rule := range LintRules {
+			linter.WithRule(rule.Name, false)
+		}
+		for _, name := range only {
+			linter.WithRule(name, true)
+		}
+	}
+	for _, name := range skip {
+		linter.WithRule(name, false)
+	}
+	if linter.lint(stmts) > 0 {
+		return errLintFindings
+	}
+	return nil
+}
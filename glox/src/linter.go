@@ -0,0 +1,584 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Named check of the linter, each of them can be toggled
+type LintRule struct {
+	Name        string
+	Description string
+}
+
+var LintRules = []LintRule{
+	{"shadowed-variable", "a declaration hides a variable of an enclosing scope"},
+	{"unreachable-code", "statements after return, break or continue"},
+	{"empty-block", "blocks without statements, function bodies are allowed to be empty"},
+	{"self-assignment", "a variable, property or element assigned to itself"},
+	{"constant-condition", "if and while conditions that never change, `while (true)` is allowed"},
+	{"inconsistent-return", "functions returning a value on some paths only"},
+	{"this-in-closure", "`this` used in a function nested in a method"},
+	{"unused-parameter", "parameters never read, unless their name starts with `_`"},
+	{"unused-function", "functions never referenced outside of their own body"},
+}
+
+func FindLintRule(name string) (*LintRule, error) {
+	for i := range LintRules {
+		if LintRules[i].Name == name {
+			return &LintRules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown lint rule '%s'.", name)
+}
+
+type lintBindingKind int
+
+const (
+	lintVariable lintBindingKind = iota
+	lintParameter
+	lintFunction
+	lintClass
+)
+
+type lintBinding struct {
+	declaration *Token
+	kind        lintBindingKind
+	isUsed      bool
+}
+
+type lintScope struct {
+	bindings map[string]*lintBinding
+	// In declaration order to report them deterministically
+	declared []*lintBinding
+}
+
+func newLintScope() *lintScope {
+	return &lintScope{
+		bindings: map[string]*lintBinding{},
+	}
+}
+
+type lintFinding struct {
+	token   *Token
+	message string
+}
+
+// State of the function being linted
+type lintFunctionState struct {
+	kind FunctionType
+	// `nil` for anonymous functions
+	name             *Token
+	valueReturn      *Token
+	bareReturn       *Token
+	enclosingMethods int
+}
+
+// Reports suspicious code that is valid Lox, the source is expected to be already resolved without errors
+type Linter struct {
+	reporter  *ErrorReporter
+	rules     map[string]bool
+	scopes    []*lintScope
+	functions []*lintFunctionState
+	// Globals referenced before being declared, e.g. a function calling one declared after it
+	globalReferences map[string]bool
+	// Some rules are only checked at the end of a scope so findings are sorted before being reported
+	findings []lintFinding
+}
+
+func NewLinter(reporter *ErrorReporter) *Linter {
+	rules := map[string]bool{}
+	for _, rule := range LintRules {
+		rules[rule.Name] = true
+	}
+	return &Linter{
+		reporter:         reporter,
+		rules:            rules,
+		scopes:           []*lintScope{newLintScope()},
+		globalReferences: map[string]bool{},
+	}
+}
+
+func (l *Linter) WithRule(name string, isEnabled bool) *Linter {
+	l.rules[name] = isEnabled
+	return l
+}
+
+// Returns the number of findings
+func (l *Linter) lint(stmts []Stmt) int {
+	l.stmts(stmts)
+	for _, binding := range l.scopes[0].declared {
+		name := binding.declaration.Lexeme
+		// `test_` functions are called by `glox test`
+		if binding.kind == lintFunction && !binding.isUsed && !l.globalReferences[name] && !strings.HasPrefix(name, "test_") {
+			l.report("unused-function", binding.declaration, fmt.Sprintf("Function '%v' is never used.", name))
+		}
+	}
+
+	slices.SortStableFunc(l.findings, func(a, b lintFinding) int {
+		return a.token.Line - b.token.Line
+	})
+	for _, finding := range l.findings {
+		l.reporter.printWarning(finding.token, finding.message)
+	}
+	return len(l.findings)
+}
+
+func (l *Linter) report(rule string, token *Token, message string) {
+	if l.rules[rule] {
+		l.findings = append(l.findings, lintFinding{token, message + " [" + rule + "]"})
+	}
+}
+
+func (l *Linter) stmts(stmts []Stmt) {
+	isReachable := true
+	for _, stmt := range stmts {
+		if !isReachable {
+			l.report("unreachable-code", stmt.firstToken(), "Unreachable code.")
+			// Reported once per block
+			isReachable = true
+		}
+		stmt.accept(l)
+		if terminates(stmt) {
+			isReachable = false
+		}
+	}
+}
+
+func (l *Linter) expr(expr Expr) {
+	expr.accept(l)
+}
+
+// `true` when the statements following [stmt] can never run
+func terminates(stmt Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *StmtReturn, *StmtBreak, *StmtContinue:
+		return true
+	case *StmtBlock:
+		if stmt.brace.Type == For {
+			return false
+		}
+		for _, s := range stmt.block {
+			if terminates(s) {
+				return true
+			}
+		}
+	case *StmtIf:
+		return stmt.elseBranch != nil && terminates(stmt.thenBranch) && terminates(stmt.elseBranch)
+	}
+	return false
+}
+
+// `true` when every path through [stmt] ends with a `return`
+func alwaysReturns(stmt Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *StmtReturn:
+		return true
+	case *StmtBlock:
+		if stmt.brace.Type == For {
+			return false
+		}
+		return listAlwaysReturns(stmt.block)
+	case *StmtIf:
+		return stmt.elseBranch != nil && alwaysReturns(stmt.thenBranch) && alwaysReturns(stmt.elseBranch)
+	}
+	return false
+}
+
+func listAlwaysReturns(stmts []Stmt) bool {
+	for _, stmt := range stmts {
+		if alwaysReturns(stmt) {
+			return true
+		}
+		if terminates(stmt) {
+			return false
+		}
+	}
+	return false
+}
+
+func (l *Linter) beginScope() {
+	l.scopes = append(l.scopes, newLintScope())
+}
+
+func (l *Linter) endScope() {
+	for _, binding := range l.scopes[len(l.scopes)-1].declared {
+		if binding.isUsed {
+			continue
+		}
+		switch binding.kind {
+		case lintParameter:
+			if !strings.HasPrefix(binding.declaration.Lexeme, "_") {
+				l.report("unused-parameter", binding.declaration,
+					fmt.Sprintf("Parameter '%v' is never used.", binding.declaration.Lexeme))
+			}
+		case lintFunction:
+			l.report("unused-function", binding.declaration,
+				fmt.Sprintf("Function '%v' is never used.", binding.declaration.Lexeme))
+		}
+	}
+	l.scopes = l.scopes[:len(l.scopes)-1]
+}
+
+func (l *Linter) declare(name *Token, kind lintBindingKind) {
+	if len(l.scopes) > 1 {
+		for i := len(l.scopes) - 2; i >= 0; i-- {
+			if shadowed, ok := l.scopes[i].bindings[name.Lexeme]; ok {
+				l.report("shadowed-variable", name, fmt.Sprintf("'%v' shadows the declaration at line %v.",
+					name.Lexeme, shadowed.declaration.Line))
+				break
+			}
+		}
+	}
+	binding := &lintBinding{
+		declaration: name,
+		kind:        kind,
+	}
+	scope := l.scopes[len(l.scopes)-1]
+	scope.bindings[name.Lexeme] = binding
+	scope.declared = append(scope.declared, binding)
+}
+
+// Marks the closest declaration of [name] as used, unless it's the function being linted calling itself
+func (l *Linter) use(name *Token) {
+	for _, function := range l.functions {
+		if function.name != nil && function.name.Lexeme == name.Lexeme {
+			return
+		}
+	}
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if binding, ok := l.scopes[i].bindings[name.Lexeme]; ok {
+			binding.isUsed = true
+			return
+		}
+	}
+	l.globalReferences[name.Lexeme] = true
+}
+
+func (l *Linter) currentFunction() *lintFunctionState {
+	if len(l.functions) == 0 {
+		return nil
+	}
+	return l.functions[len(l.functions)-1]
+}
+
+func (l *Linter) function(name *Token, function *ExprFunction, kind FunctionType) {
+	enclosingMethods := 0
+	if enclosing := l.currentFunction(); enclosing != nil {
+		enclosingMethods = enclosing.enclosingMethods
+	}
+	if kind == FunctionTypeMethod || kind == FunctionTypeInitializer {
+		enclosingMethods++
+	}
+	state := &lintFunctionState{
+		kind:             kind,
+		name:             name,
+		enclosingMethods: enclosingMethods,
+	}
+	l.functions = append(l.functions, state)
+
+	l.beginScope()
+	for _, param := range function.params {
+		l.declare(param, lintParameter)
+	}
+	l.stmts(function.body)
+	l.endScope()
+
+	l.functions = l.functions[:len(l.functions)-1]
+
+	if state.valueReturn == nil || kind == FunctionTypeInitializer {
+		return
+	}
+	if state.bareReturn != nil {
+		l.report("inconsistent-return", state.bareReturn, "Return without a value in a function returning one.")
+	} else if !listAlwaysReturns(function.body) {
+		token := name
+		if token == nil {
+			token = state.valueReturn
+		}
+		l.report("inconsistent-return", token, "Function returns a value on some paths only.")
+	}
+}
+
+func (l *Linter) condition(keyword *Token, condition Expr) {
+	if isConstant(condition) {
+		token := conditionToken(condition)
+		if token == nil {
+			token = keyword
+		}
+		l.report("constant-condition", token, "Condition is always the same.")
+	}
+	l.expr(condition)
+}
+
+// Expressions made only of literals
+func isConstant(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *ExprLiteral:
+		return true
+	case *ExprGrouping:
+		return isConstant(expr.expression)
+	case *ExprUnary:
+		return isConstant(expr.right)
+	case *ExprBinary:
+		return isConstant(expr.left) && isConstant(expr.right)
+	case *ExprLogical:
+		return isConstant(expr.left) && isConstant(expr.right)
+	}
+	return false
+}
+
+// Literals keep no token so the closest operator is reported, if any
+func conditionToken(expr Expr) *Token {
+	switch expr := expr.(type) {
+	case *ExprGrouping:
+		return conditionToken(expr.expression)
+	case *ExprUnary:
+		return expr.operator
+	case *ExprBinary:
+		return expr.operator
+	case *ExprLogical:
+		return expr.operator
+	}
+	return nil
+}
+
+// Expressions without side effects that always evaluate to the same place
+func isSameLocation(a, b Expr) bool {
+	switch a := a.(type) {
+	case *ExprVariable:
+		b, ok := b.(*ExprVariable)
+		return ok && a.name.Lexeme == b.name.Lexeme
+	case *ExprThis:
+		_, ok := b.(*ExprThis)
+		return ok
+	case *ExprGet:
+		b, ok := b.(*ExprGet)
+		return ok && a.name.Lexeme == b.name.Lexeme && isSameLocation(a.object, b.object)
+	case *ExprLiteral:
+		b, ok := b.(*ExprLiteral)
+		return ok && NewAstPrinter().print(a) == NewAstPrinter().print(b)
+	}
+	return false
+}
+
+func (l *Linter) visitBlockStmt(stmt *StmtBlock) error {
+	if len(stmt.block) == 0 {
+		l.report("empty-block", stmt.brace, "Empty block.")
+	}
+	l.beginScope()
+	l.stmts(stmt.block)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) visitClassStmt(stmt *StmtClass) error {
+	l.declare(stmt.name, lintClass)
+	if stmt.superclass != nil {
+		l.use(stmt.superclass.name)
+	}
+	for _, method := range stmt.methods {
+		kind := FunctionTypeMethod
+		if method.name.Lexeme == "init" {
+			kind = FunctionTypeInitializer
+		}
+		l.function(nil, method.function, kind)
+	}
+	for _, method := range stmt.staticMethods {
+		l.function(nil, method.function, FunctionTypeMethod)
+	}
+	return nil
+}
+
+func (l *Linter) visitFunctionStmt(stmt *StmtFunction) error {
+	l.declare(stmt.name, lintFunction)
+	l.function(stmt.name, stmt.function, FunctionTypeFunc)
+	return nil
+}
+
+func (l *Linter) visitIfStmt(stmt *StmtIf) error {
+	l.condition(stmt.keyword, stmt.condition)
+	stmt.thenBranch.accept(l)
+	if stmt.elseBranch != nil {
+		stmt.elseBranch.accept(l)
+	}
+	return nil
+}
+
+func (l *Linter) visitLoopStmt(stmt *StmtLoop) error {
+	// `while (true)` and `for (;;)` are the usual infinite loops
+	if literal, ok := stmt.condition.(*ExprLiteral); ok && literal.value == true {
+		l.expr(stmt.condition)
+	} else {
+		l.condition(stmt.keyword, stmt.condition)
+	}
+	if stmt.increment != nil {
+		l.expr(stmt.increment)
+	}
+	stmt.body.accept(l)
+	return nil
+}
+
+func (l *Linter) visitExpressionStmt(stmt *StmtExpression) error {
+	l.expr(stmt.expression)
+	return nil
+}
+
+func (l *Linter) visitPrintStmt(stmt *StmtPrint) error {
+	l.expr(stmt.expression)
+	return nil
+}
+
+func (l *Linter) visitReturnStmt(stmt *StmtReturn) error {
+	if function := l.currentFunction(); function != nil {
+		if stmt.expression == nil && function.bareReturn == nil {
+			function.bareReturn = stmt.keyword
+		} else if stmt.expression != nil && function.valueReturn == nil {
+			function.valueReturn = stmt.keyword
+		}
+	}
+	if stmt.expression != nil {
+		l.expr(stmt.expression)
+	}
+	return nil
+}
+
+func (l *Linter) visitVarStmt(stmt *StmtVar) error {
+	// The initializer can't see the variable itself
+	if stmt.initializer != nil {
+		l.expr(stmt.initializer)
+	}
+	l.declare(stmt.name, lintVariable)
+	return nil
+}
+
+func (l *Linter) visitBreakStmt(stmt *StmtBreak) error {
+	return nil
+}
+
+func (l *Linter) visitContinueStmt(stmt *StmtContinue) error {
+	return nil
+}
+
+func (l *Linter) visitAssertStmt(stmt *StmtAssert) error {
+	l.expr(stmt.condition)
+	if stmt.message != nil {
+		l.expr(stmt.message)
+	}
+	return nil
+}
+
+func (l *Linter) visitTestStmt(stmt *StmtTest) error {
+	return stmt.body.accept(l)
+}
+
+func (l *Linter) visitAssignExpr(expr *ExprAssign) (any, error) {
+	if value, ok := expr.value.(*ExprVariable); ok && value.name.Lexeme == expr.name.Lexeme {
+		l.report("self-assignment", expr.name, fmt.Sprintf("'%v' is assigned to itself.", expr.name.Lexeme))
+	}
+	l.expr(expr.value)
+	return nil, nil
+}
+
+func (l *Linter) visitBinaryExpr(expr *ExprBinary) (any, error) {
+	l.expr(expr.left)
+	l.expr(expr.right)
+	return nil, nil
+}
+
+func (l *Linter) visitFunctionExpr(expr *ExprFunction) (any, error) {
+	l.function(nil, expr, FunctionTypeFunc)
+	return nil, nil
+}
+
+func (l *Linter) visitArrayExpr(expr *ExprArray) (any, error) {
+	l.expr(expr.array)
+	l.expr(expr.index)
+	return nil, nil
+}
+
+func (l *Linter) visitArrayInstanceExpr(expr *ExprArrayInstance) (any, error) {
+	for _, argument := range expr.arguments {
+		l.expr(argument)
+	}
+	return nil, nil
+}
+
+func (l *Linter) visitCallExpr(expr *ExprCall) (any, error) {
+	l.expr(expr.callee)
+	for _, argument := range expr.arguments {
+		l.expr(argument)
+	}
+	return nil, nil
+}
+
+func (l *Linter) visitGetExpr(expr *ExprGet) (any, error) {
+	l.expr(expr.object)
+	return nil, nil
+}
+
+func (l *Linter) visitTernaryExpr(expr *ExprTernary) (any, error) {
+	l.expr(expr.condition)
+	l.expr(expr.left)
+	l.expr(expr.right)
+	return nil, nil
+}
+
+func (l *Linter) visitGroupingExpr(expr *ExprGrouping) (any, error) {
+	l.expr(expr.expression)
+	return nil, nil
+}
+
+func (l *Linter) visitLiteralExpr(expr *ExprLiteral) (any, error) {
+	return nil, nil
+}
+
+func (l *Linter) visitLogicalExpr(expr *ExprLogical) (any, error) {
+	l.expr(expr.left)
+	l.expr(expr.right)
+	return nil, nil
+}
+
+func (l *Linter) visitSetExpr(expr *ExprSet) (any, error) {
+	if value, ok := expr.value.(*ExprGet); ok && value.name.Lexeme == expr.name.Lexeme &&
+		isSameLocation(expr.object, value.object) {
+		l.report("self-assignment", expr.name, fmt.Sprintf("Property '%v' is assigned to itself.", expr.name.Lexeme))
+	}
+	l.expr(expr.object)
+	l.expr(expr.value)
+	return nil, nil
+}
+
+func (l *Linter) visitSetArrayExpr(expr *ExprSetArray) (any, error) {
+	if value, ok := expr.value.(*ExprArray); ok && isSameLocation(expr.object, value.array) &&
+		isSameLocation(expr.index, value.index) {
+		l.report("self-assignment", expr.name, "Element is assigned to itself.")
+	}
+	l.expr(expr.object)
+	l.expr(expr.index)
+	l.expr(expr.value)
+	return nil, nil
+}
+
+func (l *Linter) visitSuperExpr(expr *ExprSuper) (any, error) {
+	return nil, nil
+}
+
+func (l *Linter) visitThisExpr(expr *ExprThis) (any, error) {
+	function := l.currentFunction()
+	if function != nil && function.kind == FunctionTypeFunc && function.enclosingMethods > 0 {
+		l.report("this-in-closure", expr.keyword, "'this' in a function nested in a method refers to the method's instance.")
+	}
+	return nil, nil
+}
+
+func (l *Linter) visitUnaryExpr(expr *ExprUnary) (any, error) {
+	l.expr(expr.right)
+	return nil, nil
+}
+
+func (l *Linter) visitVariableExpr(expr *ExprVariable) (any, error) {
+	l.use(expr.name)
+	return nil, nil
+}
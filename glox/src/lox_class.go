@@ -25,10 +25,17 @@ func (c *LoxClass) arity() int {
 }
 
 func (c *LoxClass) call(interpreter *Interpreter, arguments []any) (any, error) {
+	if interpreter.profiler != nil {
+		interpreter.profiler.enter(c.name)
+		defer interpreter.profiler.exit()
+	}
 	instance := NewLoxInstance(c)
 
 	if initializer := c.FindMethod("init"); initializer != nil {
-		initializer.Bind(instance).call(interpreter, arguments)
+		_, err := initializer.Bind(instance).call(interpreter, arguments)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return instance, nil
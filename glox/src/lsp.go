@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC error codes used by the Language Server Protocol
+const (
+	lspParseError     = -32700
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspInternalError  = -32603
+)
+
+// Language server speaking JSON-RPC over stdio, documents are fully synced on each change
+type LspServer struct {
+	reader    *bufio.Reader
+	out       io.Writer
+	documents map[string]*LspDocument
+	// `true` after the `shutdown` request, `exit` then ends the server successfully
+	isShutdown bool
+}
+
+type lspMessage struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	Position     lspPosition               `json:"position"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspHover struct {
+	Contents lspMarkupContent `json:"contents"`
+	Range    lspRange         `json:"range"`
+}
+
+type lspMarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func NewLspServer(in io.Reader, out io.Writer) *LspServer {
+	return &LspServer{
+		reader:    bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*LspDocument{},
+	}
+}
+
+func lspCommand(args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox lsp [flags]")
+		fmt.Fprintln(os.Stderr, "Serves the Language Server Protocol over the standard input and output")
+		flags.PrintDefaults()
+	}
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	return NewLspServer(os.Stdin, os.Stdout).serve()
+}
+
+func (s *LspServer) serve() error {
+	for {
+		message, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message == nil {
+			s.respondError(nil, lspParseError, "Invalid JSON message.")
+			continue
+		}
+
+		if message.Method == "exit" {
+			if !s.isShutdown {
+				return fmt.Errorf("Language server exited before being shut down.")
+			}
+			return nil
+		}
+		result, rpcErr := s.handle(message)
+		// Notifications have no id and never get a response
+		if message.ID == nil {
+			continue
+		}
+		if rpcErr != nil {
+			s.respondError(message.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			s.write(&lspMessage{Jsonrpc: "2.0", ID: message.ID, Result: nullable(result)})
+		}
+	}
+}
+
+// `nil` results must be sent as `null` rather than omitted
+func nullable(result any) any {
+	if result == nil {
+		return json.RawMessage("null")
+	}
+	return result
+}
+
+// Returns a `nil` message when the body isn't valid JSON
+func (s *LspServer) read() (*lspMessage, error) {
+	body, err := readFramed(s.reader)
+	if err != nil {
+		return nil, err
+	}
+	message := &lspMessage{}
+	if json.Unmarshal(body, message) != nil {
+		return nil, nil
+	}
+	return message, nil
+}
+
+// A message that can't be encoded is logged on stderr, a response is replaced by an internal error so the
+// client doesn't wait for it
+func (s *LspServer) write(message *lspMessage) {
+	message.Jsonrpc = "2.0"
+	err := writeFramed(s.out, message)
+	if err == nil {
+		return
+	}
+	if message.ID == nil {
+		fmt.Fprintf(os.Stderr, "Can't encode the '%v' notification: %v\n", message.Method, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Can't encode the response to request %s: %v\n", *message.ID, err)
+	if message.Error == nil {
+		s.respondError(message.ID, lspInternalError, fmt.Sprintf("Can't encode the response: %v.", err))
+	}
+}
+
+// Reads the body of a message framed by a Content-Length header, like LSP and DAP do
+func readFramed(reader *bufio.Reader) ([]byte, error) {
+	headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Content-Length header: %w.", err)
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Only fails when [message] can't be encoded, nothing is written then
+func writeFramed(out io.Writer, message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return nil
+}
+
+func (s *LspServer) respondError(id *json.RawMessage, code int, message string) {
+	if id == nil {
+		id = new(json.RawMessage)
+		*id = json.RawMessage("null")
+	}
+	s.write(&lspMessage{ID: id, Error: &lspError{Code: code, Message: message}})
+}
+
+func (s *LspServer) notify(method string, params any) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't encode the '%v' notification: %v\n", method, err)
+		return
+	}
+	s.write(&lspMessage{Method: method, Params: body})
+}
+
+func (s *LspServer) handle(message *lspMessage) (any, *lspError) {
+	switch message.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]any{"name": "glox"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.isShutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument lspTextDocumentItem `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// Full sync, the last change holds the whole text
+		if len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]any{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []lspDiagnostic{},
+		})
+		return nil, nil
+	case "textDocument/definition":
+		return s.withPosition(message, func(doc *LspDocument, offset int) any {
+			return doc.definition(offset)
+		})
+	case "textDocument/references":
+		var params struct {
+			Context struct {
+				IncludeDeclaration bool `json:"includeDeclaration"`
+			} `json:"context"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.withPosition(message, func(doc *LspDocument, offset int) any {
+			return doc.references(offset, params.Context.IncludeDeclaration)
+		})
+	case "textDocument/hover":
+		return s.withPosition(message, func(doc *LspDocument, offset int) any {
+			return doc.hover(offset)
+		})
+	case "textDocument/completion":
+		return s.withPosition(message, func(doc *LspDocument, offset int) any {
+			return doc.completion(offset)
+		})
+	case "textDocument/documentSymbol":
+		var params struct {
+			TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return []lspDocumentSymbol{}, nil
+		}
+		return doc.symbols(), nil
+	}
+
+	if message.ID == nil || strings.HasPrefix(message.Method, "$/") {
+		// Unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, &lspError{Code: lspMethodNotFound, Message: fmt.Sprintf("Method '%v' not supported.", message.Method)}
+}
+
+func invalidParams(err error) *lspError {
+	return &lspError{Code: lspInvalidParams, Message: err.Error()}
+}
+
+// Runs [handler] at the byte offset of the position, unknown documents give a `null` result
+func (s *LspServer) withPosition(message *lspMessage, handler func(*LspDocument, int) any) (any, *lspError) {
+	var params lspTextDocumentPositionParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return nil, invalidParams(err)
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return handler(doc, doc.offset(params.Position)), nil
+}
+
+func (s *LspServer) update(uri, text string) {
+	doc := NewLspDocument(uri, text, s.documentConfig(uri))
+	s.documents[uri] = doc
+	s.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"diagnostics": doc.diagnostics(),
+	})
+}
+
+// The project file next to the document applies, as it would with `glox run`
+func (s *LspServer) documentConfig(uri string) *Config {
+	path := ""
+	if parsed, err := url.Parse(uri); err == nil && parsed.Scheme == "file" {
+		path = parsed.Path
+	}
+	if setupConfig(path) != nil {
+		config := ConfigWithExtras
+		return &config
+	}
+	config := GlobalConfig
+	return &config
+}
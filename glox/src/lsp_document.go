@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Symbol and completion kinds of the Language Server Protocol
+const (
+	lspSymbolClass    = 5
+	lspSymbolMethod   = 6
+	lspSymbolProperty = 7
+	lspSymbolFunction = 12
+	lspSymbolVariable = 13
+
+	lspCompletionMethod   = 2
+	lspCompletionFunction = 3
+	lspCompletionVariable = 6
+	lspCompletionClass    = 7
+	lspCompletionProperty = 10
+	lspCompletionKeyword  = 14
+)
+
+// Analysis of an open document, made again on every change
+type LspDocument struct {
+	uri    string
+	text   string
+	tokens []*Token
+	stmts  []Stmt
+	// Start offset of each line
+	lines    []int
+	bindings *Bindings
+	reported []Diagnostic
+	// Keywords of the document config, e.g. `continue` only when enabled
+	keywords map[string]TokenType
+}
+
+func NewLspDocument(uri, text string, base *Config) *LspDocument {
+	doc := &LspDocument{
+		uri:      uri,
+		text:     text,
+		lines:    []int{0},
+		bindings: NewBindings(),
+	}
+	for i := range len(text) {
+		if text[i] == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+
+	reporter := NewErrorReporter(io.Discard)
+	config := SourceConfig(text, base, reporter)
+	scanner := NewScanner(text, config, reporter)
+	// The tokens scanned despite the errors are still worth parsing
+	_ = scanner.scanTokens()
+	doc.tokens = scanner.Tokens
+	doc.keywords = scanner.keywords
+
+	stmts, err := NewParser(scanner.Tokens, config, reporter).parse()
+	doc.stmts = stmts
+	for _, parseErr := range parseErrors(err) {
+		reporter.printError(parseErr.token, parseErr.message)
+	}
+
+	// Navigation keeps working on the statements parsed correctly
+	// but their resolver errors could be caused by the broken ones so they are only shown on valid sources
+	resolverReporter := reporter
+	if reporter.hadError {
+		resolverReporter = NewErrorReporter(io.Discard)
+	}
+	NewResolver(NewInterpreter(), config, resolverReporter).WithBindings(doc.bindings).resolveStmts(stmts)
+	doc.reported = reporter.Diagnostics
+	return doc
+}
+
+// The errors joined by [Parser.parse]
+func parseErrors(err error) []*ParseError {
+	if parseErr, ok := err.(*ParseError); ok {
+		return []*ParseError{parseErr}
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	errs := []*ParseError{}
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, parseErrors(e)...)
+	}
+	return errs
+}
+
+func (doc *LspDocument) diagnostics() []lspDiagnostic {
+	diagnostics := []lspDiagnostic{}
+	for _, reported := range doc.reported {
+		severity := 1
+		if reported.IsWarning {
+			severity = 2
+		}
+		var span lspRange
+		if reported.Token != nil {
+			span = doc.tokenRange(reported.Token)
+		} else {
+			span = doc.lineRange(reported.Line)
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    span,
+			Severity: severity,
+			Source:   "glox",
+			Message:  reported.Message,
+		})
+	}
+	return diagnostics
+}
+
+// LSP positions count UTF-16 code units
+func (doc *LspDocument) position(offset int) lspPosition {
+	line := sort.Search(len(doc.lines), func(i int) bool { return doc.lines[i] > offset }) - 1
+	prefix := doc.text[doc.lines[line]:offset]
+	return lspPosition{Line: line, Character: len(utf16.Encode([]rune(prefix)))}
+}
+
+func (doc *LspDocument) offset(position lspPosition) int {
+	if position.Line >= len(doc.lines) {
+		return len(doc.text)
+	}
+	offset := doc.lines[position.Line]
+	for units := 0; units < position.Character && offset < len(doc.text) && doc.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(doc.text[offset:])
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+func (doc *LspDocument) tokenRange(token *Token) lspRange {
+	return lspRange{
+		Start: doc.position(token.Offset),
+		End:   doc.position(token.Offset + len(token.Lexeme)),
+	}
+}
+
+func (doc *LspDocument) lineRange(line int) lspRange {
+	line = min(max(line-1, 0), len(doc.lines)-1)
+	end := len(doc.text)
+	if line+1 < len(doc.lines) {
+		end = doc.lines[line+1] - 1
+	}
+	return lspRange{Start: doc.position(doc.lines[line]), End: doc.position(end)}
+}
+
+func (doc *LspDocument) location(token *Token) lspLocation {
+	return lspLocation{URI: doc.uri, Range: doc.tokenRange(token)}
+}
+
+// The identifier under the cursor, a cursor right after it counts as well
+func (doc *LspDocument) tokenAt(offset int) *Token {
+	for _, token := range doc.tokens {
+		if token.Offset > offset {
+			return nil
+		}
+		switch token.Type {
+		case Identifier, This, Super:
+			if offset <= token.Offset+len(token.Lexeme) {
+				return token
+			}
+		}
+	}
+	return nil
+}
+
+func (doc *LspDocument) declarationAt(offset int) *Token {
+	token := doc.tokenAt(offset)
+	if token == nil {
+		return nil
+	}
+	return doc.bindings.Declaration(token)
+}
+
+func (doc *LspDocument) definition(offset int) any {
+	declaration := doc.declarationAt(offset)
+	if declaration == nil {
+		return nil
+	}
+	return doc.location(declaration)
+}
+
+func (doc *LspDocument) references(offset int, includeDeclaration bool) []lspLocation {
+	locations := []lspLocation{}
+	declaration := doc.declarationAt(offset)
+	if declaration == nil {
+		return locations
+	}
+	for _, reference := range doc.bindings.References(declaration) {
+		if reference != declaration || includeDeclaration {
+			locations = append(locations, doc.location(reference))
+		}
+	}
+	return locations
+}
+
+func (doc *LspDocument) hover(offset int) any {
+	token := doc.tokenAt(offset)
+	if token == nil {
+		return nil
+	}
+	declaration := doc.bindings.Declaration(token)
+	if declaration == nil {
+		return nil
+	}
+	info := doc.bindings.Info(declaration)
+	if info == nil {
+		return nil
+	}
+	return lspHover{
+		Contents: lspMarkupContent{Kind: "markdown", Value: doc.describe(declaration, info)},
+		Range:    doc.tokenRange(token),
+	}
+}
+
+func (doc *LspDocument) describe(declaration *Token, info *BindingInfo) string {
+	var signature, details string
+	switch info.Kind {
+	case BindingVariable:
+		signature = "var " + declaration.Lexeme
+	case BindingParameter:
+		signature = "(parameter) " + declaration.Lexeme
+	case BindingFunction:
+		signature = "fun " + declaration.Lexeme + functionParams(info.Function)
+	case BindingClass:
+		hierarchy := []string{}
+		for class := info.Class; class != nil; class = doc.superclass(class) {
+			hierarchy = append(hierarchy, class.name.Lexeme)
+			if len(hierarchy) > 100 {
+				// A class inheriting from itself is reported by the resolver
+				break
+			}
+		}
+		signature = "class " + strings.Join(hierarchy, " < ")
+		methods := []string{}
+		for _, method := range info.Class.methods {
+			methods = append(methods, method.name.Lexeme+functionParams(method.function))
+		}
+		for _, method := range info.Class.staticMethods {
+			methods = append(methods, "class "+method.name.Lexeme+functionParams(method.function))
+		}
+		if len(methods) > 0 {
+			details = "\n\nMethods: `" + strings.Join(methods, "`, `") + "`"
+		}
+	}
+	return fmt.Sprintf("```lox\n%v\n```%v", signature, details)
+}
+
+func (doc *LspDocument) superclass(class *StmtClass) *StmtClass {
+	if class.superclass == nil {
+		return nil
+	}
+	declaration := doc.bindings.Declaration(class.superclass.name)
+	if declaration == nil {
+		return nil
+	}
+	if info := doc.bindings.Info(declaration); info != nil {
+		return info.Class
+	}
+	return nil
+}
+
+// Getters have no parameter list
+func functionParams(function *ExprFunction) string {
+	if function.params == nil {
+		return ""
+	}
+	params := []string{}
+	for _, param := range function.params {
+		params = append(params, param.Lexeme)
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+func (doc *LspDocument) symbols() []lspDocumentSymbol {
+	symbols := []lspDocumentSymbol{}
+	for _, stmt := range doc.stmts {
+		switch stmt := stmt.(type) {
+		case *StmtClass:
+			symbol := doc.symbol(stmt.name, lspSymbolClass, "")
+			methods := slices.Concat(stmt.methods, stmt.staticMethods)
+			slices.SortFunc(methods, func(a, b *StmtFunction) int {
+				return a.name.Offset - b.name.Offset
+			})
+			for _, method := range methods {
+				kind := lspSymbolMethod
+				if method.function.params == nil {
+					kind = lspSymbolProperty
+				}
+				symbol.Children = append(symbol.Children, doc.symbol(method.name, kind, functionParams(method.function)))
+			}
+			symbols = append(symbols, symbol)
+		case *StmtFunction:
+			symbols = append(symbols, doc.symbol(stmt.name, lspSymbolFunction, functionParams(stmt.function)))
+		case *StmtVar:
+			symbols = append(symbols, doc.symbol(stmt.name, lspSymbolVariable, ""))
+		}
+	}
+	return symbols
+}
+
+// The range goes from the keyword before the name to the end of the declaration
+func (doc *LspDocument) symbol(name *Token, kind int, detail string) lspDocumentSymbol {
+	index := slices.Index(doc.tokens, name)
+	start := index
+	if start > 0 {
+		switch doc.tokens[start-1].Type {
+		case Var, Fun, Class:
+			start--
+		}
+	}
+	end := doc.declarationEnd(index)
+	return lspDocumentSymbol{
+		Name:           name.Lexeme,
+		Detail:         detail,
+		Kind:           kind,
+		Range:          lspRange{Start: doc.tokenRange(doc.tokens[start]).Start, End: doc.tokenRange(doc.tokens[end]).End},
+		SelectionRange: doc.tokenRange(name),
+	}
+}
+
+// Index of the `;` or `}` ending the declaration whose name is at [index]
+func (doc *LspDocument) declarationEnd(index int) int {
+	depth := 0
+	for i := index; i < len(doc.tokens); i++ {
+		switch doc.tokens[i].Type {
+		case LeftBrace, LeftParen:
+			depth++
+		case RightBrace, RightParen:
+			depth--
+			if depth == 0 && doc.tokens[i].Type == RightBrace {
+				return i
+			}
+		case Semicolon:
+			if depth == 0 {
+				return i
+			}
+		case EOF:
+			return i
+		}
+	}
+	return len(doc.tokens) - 1
+}
+
+func (doc *LspDocument) completion(offset int) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if !seen[label] {
+			seen[label] = true
+			items = append(items, lspCompletionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+
+	// After a dot only properties make sense, as objects have no static type they come from the whole document
+	if doc.isAfterDot(offset) {
+		for _, declaration := range doc.bindings.Declarations() {
+			info := doc.bindings.Info(declaration)
+			if info.Kind != BindingClass {
+				continue
+			}
+			for _, method := range slices.Concat(info.Class.methods, info.Class.staticMethods) {
+				add(method.name.Lexeme, lspCompletionMethod, functionParams(method.function))
+			}
+		}
+		for i, token := range doc.tokens {
+			if i > 0 && token.Type == Identifier && doc.tokens[i-1].Type == Dot && token.Offset+len(token.Lexeme) < offset {
+				add(token.Lexeme, lspCompletionProperty, "")
+			}
+		}
+		return items
+	}
+
+	// Locals are visible from their declaration to the end of their block or function
+	builder := NewAstBuilder(doc.text)
+	for _, declaration := range doc.bindings.Declarations() {
+		scope := doc.bindings.Scope(declaration)
+		if scope != nil && (declaration.Offset > offset || offset > doc.scopeEnd(builder, scope)) {
+			continue
+		}
+		info := doc.bindings.Info(declaration)
+		switch info.Kind {
+		case BindingClass:
+			add(declaration.Lexeme, lspCompletionClass, "class")
+		case BindingFunction:
+			add(declaration.Lexeme, lspCompletionFunction, "fun "+declaration.Lexeme+functionParams(info.Function))
+		default:
+			add(declaration.Lexeme, lspCompletionVariable, "")
+		}
+	}
+	natives := []string{}
+	for name := range NewInterpreter().globals {
+		natives = append(natives, name)
+	}
+	slices.Sort(natives)
+	for _, name := range natives {
+		add(name, lspCompletionFunction, "native function")
+	}
+	keywords := []string{}
+	for keyword := range doc.keywords {
+		keywords = append(keywords, keyword)
+	}
+	slices.Sort(keywords)
+	for _, keyword := range keywords {
+		add(keyword, lspCompletionKeyword, "")
+	}
+	return items
+}
+
+// Offset right after the closing brace of [scope], or after its last token when it has none
+func (doc *LspDocument) scopeEnd(builder *AstBuilder, scope any) int {
+	var node *AstNode
+	switch scope := scope.(type) {
+	case *StmtBlock:
+		node = builder.stmt(scope)
+	case *ExprFunction:
+		node = builder.expr(scope)
+	}
+	if node == nil || node.Span == nil {
+		return len(doc.text)
+	}
+	return node.Span.End.Offset
+}
+
+// `true` when the word being typed follows a `.`
+func (doc *LspDocument) isAfterDot(offset int) bool {
+	i := min(offset, len(doc.text)) - 1
+	for i >= 0 && IsAlphaNumeric(doc.text[i]) {
+		i--
+	}
+	for i >= 0 && (doc.text[i] == ' ' || doc.text[i] == '\t') {
+		i--
+	}
+	return i >= 0 && doc.text[i] == '.'
+}
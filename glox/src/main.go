@@ -1,11 +1,13 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 )
@@ -17,49 +19,225 @@ const (
 	exRuntimeErr = 70
 )
 
-// To prevent interpreter execution on errors not triggering parser panic mode
-var hadError = false
+const usage = `Usage: glox [flags] [script]
+       glox <command> [flags] [arguments]
 
-// When `true` expressions will be evaluated in the REPL instead of throwing an error
-// For example: `3 < 2` will print `false` in the REPL and throw an error in a file.
-var isReplMode = false
+Commands:
+  run          execute a script
+  repl         start an interactive session, optionally served over a socket
+  fmt          format scripts in the canonical style
+  lint         report suspicious code, like unreachable statements or unused parameters
+  lsp          serve the Language Server Protocol on stdio for editors
+  debug        step through a script with breakpoints and inspect its variables
+  dap          serve the Debug Adapter Protocol on stdio for editors
+  doc          generate the reference of classes and functions from their doc comments
+  highlight    print a script with syntax highlighting for terminals or HTML
+  conformance  run the test suite of the Crafting Interpreters repository
+  test         run the tests of the *_test.lox files
+  doctest      run the lox code blocks of Markdown files and check their output
+  ast          print the syntax tree of a script as S-expressions, JSON or Graphviz DOT
+  bench        measure the time and allocations of a script or of its bench_* functions
+
+Flags:`
+
+// Returned by commands after printing their usage
+var errUsage = errors.New("invalid usage")
 
 var (
 	memprofile    = flag.String("memprofile", "", "write memory profile to `file`")
 	disableExtras = flag.Bool("disable-extras", false, "exclude extra features (`false` by default)")
+	warnings      = flag.String("warnings", "", "report warnings as `level`: error, warning or off")
+	optimize      = flag.Bool("O", false, "fold the constants and prune the constant branches before running")
+	// Applied after the project file and `--disable-extras`
+	enabledFeatures  featureList
+	disabledFeatures featureList
 )
 
+func init() {
+	flag.Var(&enabledFeatures, "enable", "enable the comma separated `features`")
+	flag.Var(&disabledFeatures, "disable", "disable the comma separated `features`")
+}
+
 func main() {
-	flag.Parse()
-	if *disableExtras {
-		GlobalConfig = BasicConfig
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	if len(flag.Args()) > 1 {
-		println("Usage: glox [script]")
-		os.Exit(exUsage)
-	} else if flag.Arg(0) != "" {
-		err := runFile(flag.Arg(0))
-		if err != nil {
-			switch err.(type) {
-			case *RuntimeError:
-				os.Exit(exRuntimeErr)
-			case *ParseError:
-				os.Exit(exDataErr)
-			// Scanner
-			default:
-				os.Exit(exDataErr)
-			}
+	var err error
+	switch flag.Arg(0) {
+	case "run":
+		err = runCommand(flag.Args()[1:])
+	case "repl":
+		err = replCommand(flag.Args()[1:])
+	case "fmt":
+		err = fmtCommand(flag.Args()[1:])
+	case "lint":
+		err = lintCommand(flag.Args()[1:])
+	case "lsp":
+		err = lspCommand(flag.Args()[1:])
+	case "debug":
+		err = debugCommand(flag.Args()[1:])
+	case "dap":
+		err = dapCommand(flag.Args()[1:])
+	case "doc":
+		err = docCommand(flag.Args()[1:])
+	case "highlight":
+		err = highlightCommand(flag.Args()[1:])
+	case "conformance":
+		err = conformanceCommand(flag.Args()[1:])
+	case "test":
+		err = testCommand(flag.Args()[1:])
+	case "doctest":
+		err = doctestCommand(flag.Args()[1:])
+	case "ast":
+		err = astCommand(flag.Args()[1:])
+	case "bench":
+		err = benchCommand(flag.Args()[1:])
+	default:
+		if len(flag.Args()) > 1 {
+			flag.Usage()
+			err = errUsage
+			break
 		}
-	} else {
-		err := runPrompt()
+		err = setupConfig(flag.Arg(0))
 		if err != nil {
-			os.Exit(exDataErr)
+			break
+		}
+		if flag.Arg(0) != "" {
+			err = runFile(flag.Arg(0))
+		} else {
+			err = NewRepl(os.Stdin, os.Stdout, os.Stderr, NewSessions()).run()
 		}
 	}
+
 	if *memprofile != "" {
 		saveMemProfile(*memprofile)
 	}
+	if err != nil {
+		if !isReported(err) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// Errors in the Lox source, they are reported as soon as they are found
+func isLoxError(err error) bool {
+	switch err.(type) {
+	case *RuntimeError, *ParseError, *ScanError:
+		return true
+	}
+	return false
+}
+
+// Errors already explained to the user by the time they are returned
+func isReported(err error) bool {
+	return isLoxError(err) || errors.Is(err, errUsage) || errors.Is(err, errUnformatted) ||
+		errors.Is(err, errLintFindings) || errors.Is(err, errConformanceFailures) ||
+		errors.Is(err, errTestFailures) || errors.Is(err, errDoctestFailures)
+}
+
+// Registers the flags shared by every command so they can also follow the command name
+func addCommonFlags(flags *flag.FlagSet) {
+	flags.StringVar(memprofile, "memprofile", *memprofile, "write memory profile to `file`")
+	flags.BoolVar(disableExtras, "disable-extras", *disableExtras, "exclude extra features (`false` by default)")
+	flags.StringVar(warnings, "warnings", *warnings, "report warnings as `level`: error, warning or off")
+	flags.BoolVar(optimize, "O", *optimize, "fold the constants and prune the constant branches before running")
+	flags.Var(&enabledFeatures, "enable", "enable the comma separated `features`")
+	flags.Var(&disabledFeatures, "disable", "disable the comma separated `features`")
+}
+
+// Sets [GlobalConfig] from the extras, the project file found walking up from [scriptPath] and the flags
+// The REPL has no script so the lookup starts from the working directory
+func setupConfig(scriptPath string) error {
+	config := ConfigWithExtras
+
+	project, err := FindProjectConfig(scriptDir(scriptPath))
+	if err != nil {
+		return err
+	}
+	if project != nil {
+		err = project.apply(&config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *disableExtras {
+		level := config.Warnings
+		config = BasicConfig
+		config.Warnings = level
+	}
+	for _, name := range enabledFeatures {
+		config.Set(name, true)
+	}
+	for _, name := range disabledFeatures {
+		config.Set(name, false)
+	}
+	if *warnings != "" {
+		config.Warnings, err = ParseWarningLevel(*warnings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *optimize {
+		config.Optimize = true
+	}
+
+	GlobalConfig = config
+	return nil
+}
+
+func scriptDir(scriptPath string) string {
+	if scriptPath == "" {
+		return "."
+	}
+	return filepath.Dir(scriptPath)
+}
+
+// Parses the flags of a command, on failure the usage is already printed
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(os.Stderr)
+	// Flags may also follow the arguments, as in `glox highlight file.lox --format=html`
+	arguments := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 || args[0] == "--" && len(args) == 1 {
+			break
+		}
+		if args[0] == "--" {
+			arguments = append(arguments, args[1:]...)
+			break
+		}
+		arguments = append(arguments, args[0])
+		args = args[1:]
+	}
+	flags.Parse(append([]string{"--"}, arguments...))
+	return nil
+}
+
+func exitCode(err error) int {
+	switch err.(type) {
+	case *RuntimeError:
+		return exRuntimeErr
+	case *ParseError, *ScanError:
+		return exDataErr
+	}
+	if errors.Is(err, errUsage) {
+		return exUsage
+	}
+	if errors.Is(err, errUnformatted) || errors.Is(err, errLintFindings) || errors.Is(err, errConformanceFailures) ||
+		errors.Is(err, errTestFailures) || errors.Is(err, errDoctestFailures) {
+		return 1
+	}
+	return exDataErr
 }
 
 func saveMemProfile(fileName string) {
@@ -74,59 +252,175 @@ func saveMemProfile(fileName string) {
 	}
 }
 
-func runFile(filePath string) error {
-	bytes, err := os.ReadFile(filePath)
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox run [flags] <script>")
+		flags.PrintDefaults()
+	}
+	watch := flags.Bool("watch", false, "run the script again every time it changes")
+	var reports runReports
+	flags.StringVar(&reports.profile, "profile", "", "write the time spent in each Lox function to `file` as folded stacks")
+	flags.IntVar(&reports.profileTop, "profile-top", 10, "number of functions and of lines in the profile summary printed on stderr")
+	flags.StringVar(&reports.coverage, "coverage", "", "write the statements and branches executed to `file` in the LCOV format")
+	flags.StringVar(&reports.coverageHTML, "coverage-html", "", "write the source annotated with the coverage to `file` as a standalone HTML page")
+	record := flags.String("record", "", "write the results of clock() and the other natives reading the outside world to `file`")
+	replay := flags.String("replay", "", "run with the native results recorded in `file` instead of calling the natives")
+	isAst := flags.Bool("ast", false, "the script is a syntax tree in the JSON printed by `glox ast --format=json`")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
 	if err != nil {
 		return err
 	}
-	return run(string(bytes), NewInterpreter())
-}
-
-func runPrompt() error {
-	isReplMode = true
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	isMeasured := reports.profile != "" || reports.coverage != "" || reports.coverageHTML != ""
+	if *isAst && (*watch || isMeasured) {
+		return fmt.Errorf("Can't use --ast with --watch, --profile or --coverage.")
+	}
+	if *watch {
+		if isMeasured || *record != "" || *replay != "" {
+			return fmt.Errorf("Can't use --profile, --coverage, --record or --replay with --watch.")
+		}
+		return watchFile(flags.Arg(0))
+	}
+	if *record != "" && *replay != "" {
+		return fmt.Errorf("Can't use --record with --replay.")
+	}
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if GlobalConfig.Optimize && (reports.coverage != "" || reports.coverageHTML != "") {
+		return fmt.Errorf("Can't use -O with --coverage, the pruned branches would be missing.")
+	}
 	interpreter := NewInterpreter()
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Print("> ")
-		line, err := reader.ReadString('\n')
+	if *record != "" || *replay != "" {
+		finish, err := attachInputs(interpreter, flags.Arg(0), *record, *replay)
 		if err != nil {
 			return err
 		}
-		_ = run(line, interpreter)
+		defer finish()
+	}
+	if *isAst {
+		return runAstFile(flags.Arg(0), interpreter)
 	}
+	if isMeasured {
+		return runMeasured(flags.Arg(0), reports, interpreter)
+	}
+	return runFileWith(flags.Arg(0), interpreter)
 }
 
-func run(source string, interpreter *Interpreter) (err error) {
-	scanner := NewScanner(source)
-	err = scanner.scanTokens()
+// Reports of `glox run` about the execution of the script, empty paths are skipped
+type runReports struct {
+	profile      string
+	profileTop   int
+	coverage     string
+	coverageHTML string
+}
+
+// The reports are written even when the script fails
+func runMeasured(filePath string, reports runReports, interpreter *Interpreter) error {
+	bytes, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
-
-	parser := NewParser(scanner.Tokens)
-	stmts, err := parser.parse()
+	source := string(bytes)
+	stmts, err := compileSource(source, interpreter, NewErrorReporter(interpreter.stderr), false)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
+	if reports.coverage != "" || reports.coverageHTML != "" {
+		interpreter.coverage = NewCoverage()
+		interpreter.coverage.register(filePath, source, stmts)
+	}
+	if reports.profile != "" {
+		interpreter.profiler = NewProfiler()
+	}
+
+	runErr := interpreter.interpret(stmts)
+	if runErr != nil {
+		fmt.Fprintln(interpreter.stderr, runErr)
+	}
+
+	if interpreter.profiler != nil {
+		interpreter.profiler.stop()
+		err = writeReport(reports.profile, interpreter.profiler.writeFolded)
+		if err != nil {
+			return err
+		}
+		interpreter.profiler.writeSummary(os.Stderr, reports.profileTop)
+	}
+	if interpreter.coverage != nil {
+		err = writeReport(reports.coverage, interpreter.coverage.writeLcov)
+		if err != nil {
+			return err
+		}
+		err = writeReport(reports.coverageHTML, interpreter.coverage.writeHTML)
+		if err != nil {
+			return err
+		}
+	}
+	return runErr
+}
 
-	// For errors not propagated to the `parse()` return
-	if hadError {
-		return NewParserError(parser.peek(), "Don't run interpreter due to previous errors.")
+func writeReport(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return nil
 	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return write(out)
+}
 
-	resolver := NewResolver(interpreter)
-	// The resolver never returns errors so we can safely skip the check
-	resolver.resolveStmts(stmts)
+func runFile(filePath string) error {
+	return runFileWith(filePath, NewInterpreter())
+}
 
-	if hadError {
-		return NewParserError(parser.peek(), "Don't run interpreter due to previous errors.")
+func runFileWith(filePath string, interpreter *Interpreter) error {
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
 	}
+	return run(string(bytes), interpreter, false)
+}
 
+func run(source string, interpreter *Interpreter, isReplMode bool) error {
+	// The pragmas of the source only last for its execution
+	sessionConfig := interpreter.config
+	defer func() {
+		interpreter.config = sessionConfig
+	}()
+	stmts, err := compileSource(source, interpreter, NewErrorReporter(interpreter.stderr), isReplMode)
+	if err != nil {
+		return err
+	}
 	err = interpreter.interpret(stmts)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(interpreter.stderr, err)
 		return err
 	}
 	return nil
 }
+
+// Scans, parses and resolves a script without running it, [interpreter] takes the config of the source
+func compileSource(source string, interpreter *Interpreter, reporter *ErrorReporter, isReplMode bool) ([]Stmt, error) {
+	interpreter.config = SourceConfig(source, interpreter.config, reporter)
+	stmts, tokens, err := parseSource(source, interpreter.config, reporter, false, isReplMode)
+	if err != nil {
+		return nil, err
+	}
+	NewResolver(interpreter, interpreter.config, reporter).resolveStmts(stmts)
+	if reporter.hadError {
+		return nil, NewParserError(tokens[len(tokens)-1], "Can't continue due to previous errors.")
+	}
+	if interpreter.config.Optimize {
+		stmts = NewOptimizer(interpreter.config).optimize(stmts)
+	}
+	return stmts, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import "math"
+
+// Folds the constant expressions and prunes the branches of the constant conditions between
+// the resolution and the execution, enabled by `-O`. The constants are evaluated by the interpreter
+// itself so the results are the same, and an expression failing is kept to fail when run
+type Optimizer struct {
+	// Evaluates the constant expressions with the config of the source, e.g. for the implicit string casts
+	interpreter *Interpreter
+	// Nodes of the assertions, kept as written so their failures show the source
+	kept map[any]bool
+}
+
+func NewOptimizer(config *Config) *Optimizer {
+	interpreter := NewInterpreter()
+	interpreter.config = config
+	return &Optimizer{interpreter: interpreter, kept: map[any]bool{}}
+}
+
+func (o *Optimizer) optimize(stmts []Stmt) []Stmt {
+	keep := func(node any) bool {
+		o.kept[node] = true
+		return true
+	}
+	for _, stmt := range stmts {
+		Walk(stmt, func(node any) bool {
+			if assert, ok := node.(*StmtAssert); ok {
+				Walk(assert, keep, nil)
+				return false
+			}
+			return true
+		}, nil)
+	}
+	return RewriteStmts(stmts, o.rewrite)
+}
+
+// The children are already rewritten so folding goes from the leaves up
+func (o *Optimizer) rewrite(node any) any {
+	if o.kept[node] {
+		return node
+	}
+	switch node := node.(type) {
+	case *ExprGrouping:
+		if isLiteral(node.expression) {
+			return node.expression
+		}
+	case *ExprUnary:
+		if isLiteral(node.right) {
+			return o.fold(node)
+		}
+	case *ExprBinary:
+		return o.binary(node)
+	case *ExprLogical:
+		if left, ok := node.left.(*ExprLiteral); ok {
+			if isTruthy(left.value) != (node.operator.Type == And) {
+				return left
+			}
+			return node.right
+		}
+	case *ExprTernary:
+		// Both branches are evaluated before picking one, the other one can only go when evaluating it does nothing
+		if condition, ok := node.condition.(*ExprLiteral); ok {
+			if value, ok := condition.value.(bool); ok {
+				if value && isPure(node.right) {
+					return node.left
+				}
+				if !value && isPure(node.left) {
+					return node.right
+				}
+			}
+		}
+	case *StmtIf:
+		if condition, ok := node.condition.(*ExprLiteral); ok {
+			if isTruthy(condition.value) {
+				return node.thenBranch
+			}
+			if node.elseBranch != nil {
+				return node.elseBranch
+			}
+			return NewStmtBlock(node.keyword, []Stmt{})
+		}
+	case *StmtLoop:
+		if condition, ok := node.condition.(*ExprLiteral); ok && !isTruthy(condition.value) {
+			return NewStmtBlock(node.keyword, []Stmt{})
+		}
+	}
+	return node
+}
+
+// The literal of the value of [expr], whose operands are literals, or [expr] itself when it fails,
+// even by panicking, as it may be code that never runs
+func (o *Optimizer) fold(expr Expr) (folded Expr) {
+	defer func() {
+		if recover() != nil {
+			folded = expr
+		}
+	}()
+	value, err := expr.accept(o.interpreter)
+	if err != nil {
+		return expr
+	}
+	return NewExprLiteral(value).WithFresh(isOfType[[]byte](value))
+}
+
+// `x * 1`, `x / 1` and `x - 0` are `x` for numbers, `x + 0` too unless `x` is -0 as -0 + 0 is 0
+func (o *Optimizer) binary(expr *ExprBinary) Expr {
+	if expr.operator.Type == Comma && isLiteral(expr.left) {
+		return expr.right
+	}
+	if isLiteral(expr.left) && isLiteral(expr.right) {
+		return o.fold(expr)
+	}
+
+	isLeftNumber, isLeftNegativeZero := numberType(expr.left)
+	isRightNumber, isRightNegativeZero := numberType(expr.right)
+	switch expr.operator.Type {
+	case Star:
+		if isLeftNumber && isNumberLiteral(expr.right, 1) {
+			return expr.left
+		}
+		if isRightNumber && isNumberLiteral(expr.left, 1) {
+			return expr.right
+		}
+	case Slash:
+		if isLeftNumber && isNumberLiteral(expr.right, 1) {
+			return expr.left
+		}
+	case Minus:
+		if isLeftNumber && isNumberLiteral(expr.right, 0) {
+			return expr.left
+		}
+	case Plus:
+		if isLeftNumber && !isLeftNegativeZero && isNumberLiteral(expr.right, 0) {
+			return expr.left
+		}
+		if isRightNumber && !isRightNegativeZero && isNumberLiteral(expr.left, 0) {
+			return expr.right
+		}
+	}
+	return expr
+}
+
+func isLiteral(expr Expr) bool {
+	_, ok := expr.(*ExprLiteral)
+	return ok
+}
+
+// Only +0 for 0, `x - -0` is `x + 0`
+func isNumberLiteral(expr Expr, number float64) bool {
+	literal, ok := expr.(*ExprLiteral)
+	if !ok {
+		return false
+	}
+	value, ok := literal.value.(float64)
+	return ok && value == number && !math.Signbit(value)
+}
+
+// Whether [expr] evaluates to a number unless it fails, and whether that number can be -0
+func numberType(expr Expr) (isNumber bool, mayBeNegativeZero bool) {
+	switch expr := expr.(type) {
+	case *ExprLiteral:
+		value, ok := expr.value.(float64)
+		return ok, ok && value == 0 && math.Signbit(value)
+	case *ExprGrouping:
+		return numberType(expr.expression)
+	case *ExprUnary:
+		return expr.operator.Type == Minus, true
+	case *ExprBinary:
+		switch expr.operator.Type {
+		case Minus, Star, Slash:
+			return true, true
+		case Percent:
+			// The remainder is computed on integers
+			return true, false
+		case Plus:
+			isLeftNumber, isLeftNegativeZero := numberType(expr.left)
+			isRightNumber, isRightNegativeZero := numberType(expr.right)
+			return isLeftNumber && isRightNumber, isLeftNegativeZero && isRightNegativeZero
+		}
+	}
+	return false, false
+}
+
+// Evaluating it can't fail nor change anything
+func isPure(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *ExprLiteral, *ExprFunction:
+		return true
+	case *ExprGrouping:
+		return isPure(expr.expression)
+	}
+	return false
+}
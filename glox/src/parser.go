@@ -9,6 +9,7 @@ import (
 // declaration    → classDecl
 //                | funDecl
 //                | varDecl
+//                | testDecl
 //                | statement ;
 // classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" ( function | getter )* "}" ;
 // funDecl        → "fun" function ;
@@ -16,16 +17,19 @@ import (
 // getter         → IDENTIFIER block ;
 // parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
 // varDecl        → "var" IDENTIFIER ( "=" commaOperator )? ";" ;
+// testDecl       → "test" STRING block ; // `test` is only a keyword before a string
 // statement      → exprStmt
 //                | ifStmt
 //                | printStmt
 //                | returnStmt
 //                | whileStmt
 //                | forStmt
+//                | assertStmt
 //                | block
 //                | "break" ; // This is not context free as it is only valid in `while` and `for` loops
 
 // returnStmt     → "return" expression? ";" ;
+// assertStmt     → "assert" expression ( "," expression )? ";" ;
 // while          → while "(" commaOperator ")" statement ;
 // for            → for "(" ( varDecl | exprStmt ";" )
 //                  commaOperator? ";"
@@ -73,17 +77,29 @@ func (e *ParseError) Error() string {
 
 type Parser struct {
 	tokens           []*Token
+	config           *Config
+	reporter         *ErrorReporter
 	current          int
 	nestedLoopsCount int
+	// When `true` expressions will be evaluated in the REPL instead of throwing an error
+	// For example: `3 < 2` will print `false` in the REPL and throw an error in a file.
+	isReplMode bool
 }
 
-func NewParser(tokens []*Token) *Parser {
+func NewParser(tokens []*Token, config *Config, reporter *ErrorReporter) *Parser {
 	return &Parser{
-		tokens:  tokens,
-		current: 0,
+		tokens:   tokens,
+		config:   config,
+		reporter: reporter,
+		current:  0,
 	}
 }
 
+func (p *Parser) WithReplMode(isReplMode bool) *Parser {
+	p.isReplMode = isReplMode
+	return p
+}
+
 func (p *Parser) parse() (statements []Stmt, err error) {
 	// To ensure the parser returns all errors concatenated in order
 	errors := []error{}
@@ -92,8 +108,9 @@ func (p *Parser) parse() (statements []Stmt, err error) {
 		stmt, declarationErr := p.declaration()
 		if declarationErr != nil {
 			errors = append(errors, declarationErr)
+		} else {
+			statements = append(statements, stmt)
 		}
-		statements = append(statements, stmt)
 	}
 
 	if len(errors) == 0 {
@@ -104,7 +121,8 @@ func (p *Parser) parse() (statements []Stmt, err error) {
 	for i := 1; i < len(errors); i++ {
 		err = fmt.Errorf("%w\n%w", err, errors[i])
 	}
-	return nil, err
+	// The statements parsed correctly are kept for tools working on incomplete sources
+	return statements, err
 }
 
 func (p *Parser) declaration() (stmt Stmt, err error) {
@@ -123,12 +141,30 @@ func (p *Parser) declaration() (stmt Stmt, err error) {
 		return p.function("function")
 	} else if p.match(Class) {
 		return p.classDeclaration()
+	} else if p.config.AllowTestBlocks && p.check(Identifier) && p.peek().Lexeme == "test" && p.checkNext(String) {
+		p.advance()
+		return p.testDeclaration()
 	}
 
 	return p.statement()
 }
 
+func (p *Parser) testDeclaration() (Stmt, error) {
+	keyword := p.previous()
+	name := p.advance()
+	brace, err := p.consume(LeftBrace, "Expect '{' before test body.")
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return NewStmtTest(keyword, name, NewStmtBlock(brace, body).WithEnd(p.previous())), nil
+}
+
 func (p *Parser) classDeclaration() (Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(Identifier, "Expect class name.")
 	if err != nil {
 		return nil, err
@@ -157,7 +193,7 @@ func (p *Parser) classDeclaration() (Stmt, error) {
 		}
 
 		kind := "method"
-		if GlobalConfig.AllowGettersInClasses && !isStaticMethod && p.checkNext(LeftBrace) {
+		if p.config.AllowGettersInClasses && !isStaticMethod && p.checkNext(LeftBrace) {
 			kind = "getter"
 		}
 
@@ -173,14 +209,21 @@ func (p *Parser) classDeclaration() (Stmt, error) {
 		}
 	}
 
-	_, err = p.consume(RightBrace, "Expect '}' after class body.")
+	end, err := p.consume(RightBrace, "Expect '}' after class body.")
 	if err != nil {
 		return nil, err
 	}
-	return NewStmtClass(name, superclass, methods, staticMethods), nil
+	return NewStmtClass(name, superclass, methods, staticMethods).WithDoc(docComment(keyword)).WithKeyword(keyword).WithEnd(end), nil
 }
 
 func (p *Parser) function(kind string) (stmt *StmtFunction, err error) {
+	// The doc comment is above `fun` for functions and `class` for static methods
+	var keyword *Token
+	first := p.peek()
+	if p.current > 0 && (p.previous().Type == Fun || p.previous().Type == Class) {
+		keyword = p.previous()
+		first = keyword
+	}
 	name, err := p.consume(Identifier, "Expect "+kind+" name.")
 	if err != nil {
 		return nil, err
@@ -191,7 +234,7 @@ func (p *Parser) function(kind string) (stmt *StmtFunction, err error) {
 		return nil, err
 	}
 
-	return NewStmtFunction(name, function), nil
+	return NewStmtFunction(name, function).WithDoc(docComment(first)).WithKeyword(keyword), nil
 }
 
 func (p *Parser) functionBody(kind string) (functionExpr *ExprFunction, err error) {
@@ -215,7 +258,7 @@ func (p *Parser) functionBody(kind string) (functionExpr *ExprFunction, err erro
 		return nil, err
 	}
 
-	return NewExprFunction(parameters, body), nil
+	return NewExprFunction(parameters, body).WithEnd(p.previous()), nil
 }
 
 func (p *Parser) functionParameters(kind string) (parameters []*Token, err error) {
@@ -228,7 +271,7 @@ func (p *Parser) functionParameters(kind string) (parameters []*Token, err error
 	for !p.check(RightParen) {
 		if len(parameters) >= 255 {
 			// Error here is just shown but doesn't stop parser execution as the parser is not in panic mode
-			printError(p.peek(), "Can't have more than 255 parameters.")
+			p.reporter.printError(p.peek(), "Can't have more than 255 parameters.")
 		}
 
 		param, err := p.consume(Identifier, "Expect parameter name.")
@@ -266,6 +309,7 @@ func (p *Parser) block() (stmts []Stmt, err error) {
 }
 
 func (p *Parser) varDeclaration() (stmt Stmt, err error) {
+	keyword := p.previous()
 	name, err := p.consume(Identifier, "Expect variable name.")
 	if err != nil {
 		return nil, err
@@ -277,12 +321,12 @@ func (p *Parser) varDeclaration() (stmt Stmt, err error) {
 			return nil, err
 		}
 	}
-	_, err = p.consume(Semicolon, "Expect ';' after variable declaration.")
+	end, err := p.consume(Semicolon, "Expect ';' after variable declaration.")
 	if err != nil {
 		return nil, err
 	}
 
-	return NewStmtVar(name, initializer), nil
+	return NewStmtVar(name, initializer).WithKeyword(keyword).WithEnd(end), nil
 }
 
 func (p *Parser) statement() (Stmt, error) {
@@ -302,11 +346,28 @@ func (p *Parser) statement() (Stmt, error) {
 		return p.breakStatement()
 	} else if p.match(Continue) {
 		return p.continueStatement()
+	} else if p.isAssertStatement() {
+		p.advance()
+		return p.assertStatement()
 	}
 	return p.expressionStatement()
 }
 
+// `assert` is only a keyword when an expression follows it, like `test` it can still name variables and functions
+// so `assert(x)` and `assert - 1` stay a call and a subtraction
+func (p *Parser) isAssertStatement() bool {
+	if !p.config.AllowAssertStatement || !p.check(Identifier) || p.peek().Lexeme != "assert" {
+		return false
+	}
+	switch p.tokens[p.current+1].Type {
+	case Identifier, String, Number, True, False, Nil, This, Super, Bang, Fun, Array:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) ifStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(LeftParen, "Expect '(' after 'if'.")
 	if err != nil {
 		return nil, err
@@ -330,10 +391,11 @@ func (p *Parser) ifStatement() (Stmt, error) {
 			return nil, err
 		}
 	}
-	return NewStmtIf(condition, thenBranch, elseBranch), nil
+	return NewStmtIf(keyword, condition, thenBranch, elseBranch), nil
 }
 
 func (p *Parser) whileStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(LeftParen, "Expect '(' after 'while'.")
 	if err != nil {
 		return nil, err
@@ -356,10 +418,11 @@ func (p *Parser) whileStatement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewStmtLoop(condition, nil, body), nil
+	return NewStmtLoop(keyword, condition, nil, body), nil
 }
 
 func (p *Parser) forStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(LeftParen, "Expect '(' after 'for'.")
 	if err != nil {
 		return nil, err
@@ -416,10 +479,11 @@ func (p *Parser) forStatement() (Stmt, error) {
 	if condition == nil {
 		condition = NewExprLiteral(true)
 	}
-	body = NewStmtLoop(condition, increment, body)
+	body = NewStmtLoop(keyword, condition, increment, body)
 
 	if initializer != nil {
-		body = NewStmtBlock([]Stmt{
+		// The `for` keyword stands for the brace of the block scoping the initializer
+		body = NewStmtBlock(keyword, []Stmt{
 			initializer,
 			body,
 		})
@@ -429,17 +493,18 @@ func (p *Parser) forStatement() (Stmt, error) {
 }
 
 func (p *Parser) blockStatement() (Stmt, error) {
+	brace := p.previous()
 	statements, err := p.block()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewStmtBlock(statements), nil
+	return NewStmtBlock(brace, statements).WithEnd(p.previous()), nil
 }
 
 func (p *Parser) breakStatement() (Stmt, error) {
 	breakToken := p.previous()
-	_, err := p.consume(Semicolon, "Expect ';' after 'break'.")
+	end, err := p.consume(Semicolon, "Expect ';' after 'break'.")
 	if err != nil {
 		return nil, err
 	}
@@ -447,12 +512,12 @@ func (p *Parser) breakStatement() (Stmt, error) {
 	if p.nestedLoopsCount <= 0 {
 		return nil, NewParserError(breakToken, "Only valid in 'while' and 'for' loops.")
 	}
-	return NewStmtBreak(), nil
+	return NewStmtBreak(breakToken).WithEnd(end), nil
 }
 
 func (p *Parser) continueStatement() (Stmt, error) {
 	continueToken := p.previous()
-	_, err := p.consume(Semicolon, "Expect ';' after 'continue'.")
+	end, err := p.consume(Semicolon, "Expect ';' after 'continue'.")
 	if err != nil {
 		return nil, err
 	}
@@ -460,19 +525,40 @@ func (p *Parser) continueStatement() (Stmt, error) {
 	if p.nestedLoopsCount <= 0 {
 		return nil, NewParserError(continueToken, "Only valid in 'while' and 'for' loops.")
 	}
-	return NewStmtContinue(), nil
+	return NewStmtContinue(continueToken).WithEnd(end), nil
+}
+
+func (p *Parser) assertStatement() (Stmt, error) {
+	keyword := p.previous()
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	var message Expr
+	if p.match(Comma) {
+		message, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+	end, err := p.consume(Semicolon, "Expect ';' after assertion.")
+	if err != nil {
+		return nil, err
+	}
+	return NewStmtAssert(keyword, condition, message).WithEnd(end), nil
 }
 
 func (p *Parser) printStatement() (Stmt, error) {
+	keyword := p.previous()
 	value, err := p.commaOperator()
 	if err != nil {
 		return nil, err
 	}
-	_, err = p.consume(Semicolon, "Expect ';' after value.")
+	end, err := p.consume(Semicolon, "Expect ';' after value.")
 	if err != nil {
 		return nil, err
 	}
-	return NewStmtPrint(value), nil
+	return NewStmtPrint(keyword, value).WithEnd(end), nil
 }
 
 func (p *Parser) returnStatement() (stmt Stmt, err error) {
@@ -486,24 +572,25 @@ func (p *Parser) returnStatement() (stmt Stmt, err error) {
 		}
 	}
 
-	_, err = p.consume(Semicolon, "Expect ';' after value.")
+	end, err := p.consume(Semicolon, "Expect ';' after value.")
 	if err != nil {
 		return nil, err
 	}
-	return NewStmtReturn(keyword, value), nil
+	return NewStmtReturn(keyword, value).WithEnd(end), nil
 }
 
 func (p *Parser) expressionStatement() (Stmt, error) {
+	first := p.peek()
 	value, err := p.commaOperator()
 	if err != nil {
 		return nil, err
 	}
-	_, err = p.consume(Semicolon, "Expect ';' after expression.")
+	end, err := p.consume(Semicolon, "Expect ';' after expression.")
 	if err == nil {
-		return NewStmtExpression(value), nil
-	} else if isReplMode && p.isAtEnd() {
+		return NewStmtExpression(first, value).WithEnd(end), nil
+	} else if p.isReplMode && p.isAtEnd() {
 		// Mimic last expression evaluation in the REPL when no `;` is found
-		return NewStmtPrint(value), nil
+		return NewStmtPrint(first, value), nil
 	}
 	return nil, err
 }
@@ -738,11 +825,11 @@ func (p *Parser) array() (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			_, err = p.consume(RightBracket, "Expect ']' after array access.")
+			end, err := p.consume(RightBracket, "Expect ']' after array access.")
 			if err != nil {
 				return nil, err
 			}
-			expr = NewExprArray(expr, bracket, index)
+			expr = NewExprArray(expr, bracket, index).WithEnd(end)
 		} else {
 			break
 		}
@@ -799,7 +886,7 @@ func (p *Parser) arguments() ([]Expr, error) {
 	for {
 		if len(arguments) >= 255 {
 			// Error here is just shown but doesn't stop parser execution as the parser is not in panic mode
-			printError(p.peek(), "Can't have more than 255 arguments.")
+			p.reporter.printError(p.peek(), "Can't have more than 255 arguments.")
 		}
 
 		arg, err := p.expression()
@@ -817,31 +904,33 @@ func (p *Parser) arguments() ([]Expr, error) {
 
 func (p *Parser) primary() (Expr, error) {
 	if p.match(False) {
-		return NewExprLiteral(false), nil
+		return NewExprLiteral(false).WithToken(p.previous()), nil
 	} else if p.match(True) {
-		return NewExprLiteral(true), nil
+		return NewExprLiteral(true).WithToken(p.previous()), nil
 	} else if p.match(Nil) {
-		return NewExprLiteral(nil), nil
+		return NewExprLiteral(nil).WithToken(p.previous()), nil
 	} else if p.match(Number, String) {
-		return NewExprLiteral(p.previous().Literal), nil
+		return NewExprLiteral(p.previous().Literal).WithToken(p.previous()), nil
 	} else if p.match(LeftParen) {
+		paren := p.previous()
 		expr, err := p.expression()
 		if err != nil {
 			return nil, err
 		}
-		_, err = p.consume(RightParen, "Expect ')' after expression.")
+		end, err := p.consume(RightParen, "Expect ')' after expression.")
 		if err != nil {
 			return nil, err
 		}
-		return NewExprGrouping(expr), nil
+		return NewExprGrouping(expr).WithParen(paren).WithEnd(end), nil
 	} else if p.match(Identifier) {
 		return NewExprVariable(p.previous()), nil
-	} else if GlobalConfig.AllowAnonymousFunctions && p.match(Fun) {
+	} else if p.config.AllowAnonymousFunctions && p.match(Fun) {
+		keyword := p.previous()
 		function, err := p.functionBody("function")
 		if err != nil {
 			return nil, err
 		}
-		return NewExprFunction(function.params, function.body), nil
+		return function.WithKeyword(keyword), nil
 	} else if p.match(This) {
 		return NewExprThis(p.previous()), nil
 	} else if p.match(Super) {
@@ -857,6 +946,7 @@ func (p *Parser) primary() (Expr, error) {
 
 		return NewExprSuper(keyword, method), nil
 	} else if p.match(Array) {
+		keyword := p.previous()
 		_, err := p.consume(LeftBrace, "Expect '{' after 'Array'.")
 		if err != nil {
 			return nil, err
@@ -870,12 +960,12 @@ func (p *Parser) primary() (Expr, error) {
 			}
 		}
 
-		_, err = p.consume(RightBrace, "Expect '}' after 'Array{...'.")
+		end, err := p.consume(RightBrace, "Expect '}' after 'Array{...'.")
 		if err != nil {
 			return nil, err
 		}
 
-		return NewExprArrayInstance(arguments), nil
+		return NewExprArrayInstance(arguments).WithKeyword(keyword).WithEnd(end), nil
 	}
 	return nil, NewParserError(p.peek(), "Expect expression.")
 }
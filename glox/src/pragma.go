@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const pragmaPrefix = "lox:"
+
+// Returns the config of a single source, adjusted by the pragmas in its leading comments:
+//
+//	// lox: extras=off enable=ternary,arrays disable=ImplicitStringCast warnings=warning
+//
+// Pragmas are only read until the first line that is neither blank nor a `//` comment
+// Invalid pragmas are reported and [base] is never modified
+func SourceConfig(source string, base *Config, reporter *ErrorReporter) *Config {
+	config := *base
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		comment, ok := strings.CutPrefix(line, "//")
+		if !ok {
+			break
+		}
+		pragma, ok := strings.CutPrefix(strings.TrimSpace(comment), pragmaPrefix)
+		if !ok {
+			continue
+		}
+		for _, directive := range strings.Fields(pragma) {
+			err := applyPragma(&config, directive)
+			if err != nil {
+				reporter.report(i+1, "", err.Error())
+			}
+		}
+	}
+	return &config
+}
+
+func applyPragma(config *Config, directive string) error {
+	key, value, ok := strings.Cut(directive, "=")
+	if !ok {
+		return fmt.Errorf("Expect 'key=value' in pragma but got '%s'.", directive)
+	}
+
+	switch key {
+	case "enable", "disable":
+		for _, name := range strings.Split(value, ",") {
+			err := config.Set(name, key == "enable")
+			if err != nil {
+				return err
+			}
+		}
+	case "extras":
+		level := config.Warnings
+		switch value {
+		case "on":
+			*config = ConfigWithExtras
+		case "off":
+			*config = BasicConfig
+		default:
+			return fmt.Errorf("Expect 'on' or 'off' for pragma 'extras'.")
+		}
+		config.Warnings = level
+	case "warnings":
+		level, err := ParseWarningLevel(value)
+		if err != nil {
+			return err
+		}
+		config.Warnings = level
+	default:
+		return fmt.Errorf("Unknown pragma '%s'.", key)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Times the Lox calls, functions are labelled `name:line` and natives and constructors by their name,
+// and the source lines from the statements being executed
+type Profiler struct {
+	stack []*profileCall
+	// Self time of each call stack, labels joined by `;`
+	stacks    map[string]time.Duration
+	functions map[string]*ProfileEntry
+	// Self time of each source line, the calls made by a line count for the lines they execute
+	lines map[int]time.Duration
+	now   func() time.Time
+}
+
+type ProfileEntry struct {
+	Label string
+	Calls int
+	// Time spent in the function itself
+	Self time.Duration
+	// Time spent in the function and its callees, recursive calls are counted once
+	Total time.Duration
+	// Active calls, only the outermost one adds to the total
+	depth int
+}
+
+type profileCall struct {
+	entry    *ProfileEntry
+	stack    string
+	start    time.Time
+	children time.Duration
+	// Line being executed, natives and constructors go on with the line calling them
+	line      int
+	lineStart time.Time
+}
+
+// The script itself is the root of the stacks until [Profiler.stop]
+func NewProfiler() *Profiler {
+	profiler := &Profiler{
+		stacks:    map[string]time.Duration{},
+		functions: map[string]*ProfileEntry{},
+		lines:     map[int]time.Duration{},
+		now:       time.Now,
+	}
+	profiler.enter("<script>")
+	return profiler
+}
+
+func (p *Profiler) enter(label string) {
+	entry, ok := p.functions[label]
+	if !ok {
+		entry = &ProfileEntry{Label: label}
+		p.functions[label] = entry
+	}
+	entry.Calls++
+	entry.depth++
+
+	now := p.now()
+	stack := label
+	line := 0
+	if len(p.stack) > 0 {
+		caller := p.stack[len(p.stack)-1]
+		p.chargeLine(caller, now)
+		stack = caller.stack + ";" + label
+		line = caller.line
+	}
+	p.stack = append(p.stack, &profileCall{entry: entry, stack: stack, start: now, line: line, lineStart: now})
+}
+
+func (p *Profiler) exit() {
+	call := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	now := p.now()
+	p.chargeLine(call, now)
+	elapsed := now.Sub(call.start)
+	self := elapsed - call.children
+	p.stacks[call.stack] += self
+	call.entry.Self += self
+	call.entry.depth--
+	if call.entry.depth == 0 {
+		call.entry.Total += elapsed
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+		p.stack[len(p.stack)-1].lineStart = now
+	}
+}
+
+// Called before each statement, the time since the previous one goes to the previous line
+func (p *Profiler) line(line int) {
+	call := p.stack[len(p.stack)-1]
+	p.chargeLine(call, p.now())
+	call.line = line
+}
+
+func (p *Profiler) chargeLine(call *profileCall, now time.Time) {
+	if call.line != 0 {
+		p.lines[call.line] += now.Sub(call.lineStart)
+	}
+	call.lineStart = now
+}
+
+// Closes the calls still open, e.g. after a runtime error, and the script itself
+func (p *Profiler) stop() {
+	for len(p.stack) > 0 {
+		p.exit()
+	}
+}
+
+// One line per call stack with its self time in microseconds, as read by flame graph tools
+func (p *Profiler) writeFolded(out io.Writer) error {
+	stacks := []string{}
+	for stack := range p.stacks {
+		stacks = append(stacks, stack)
+	}
+	slices.Sort(stacks)
+	for _, stack := range stacks {
+		_, err := fmt.Fprintf(out, "%v %d\n", stack, p.stacks[stack].Microseconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The [count] functions with the most self time, the script itself included
+func (p *Profiler) top(count int) []*ProfileEntry {
+	entries := []*ProfileEntry{}
+	for _, entry := range p.functions {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b *ProfileEntry) int {
+		return cmp.Or(cmp.Compare(b.Self, a.Self), strings.Compare(a.Label, b.Label))
+	})
+	return entries[:min(count, len(entries))]
+}
+
+// The [count] lines with the most self time
+func (p *Profiler) topLines(count int) []int {
+	lines := []int{}
+	for line := range p.lines {
+		lines = append(lines, line)
+	}
+	slices.SortFunc(lines, func(a, b int) int {
+		return cmp.Or(cmp.Compare(p.lines[b], p.lines[a]), cmp.Compare(a, b))
+	})
+	return lines[:min(count, len(lines))]
+}
+
+func (p *Profiler) writeSummary(out io.Writer, count int) {
+	total := p.functions["<script>"].Total
+	fmt.Fprintf(out, "Lox profile, %v total\n", total.Round(time.Microsecond))
+	fmt.Fprintf(out, "%10v %12v %7v %12v %7v  %v\n", "calls", "self", "self%", "total", "total%", "function")
+	for _, entry := range p.top(count) {
+		fmt.Fprintf(
+			out,
+			"%10d %12v %6.1f%% %12v %6.1f%%  %v\n",
+			entry.Calls,
+			entry.Self.Round(time.Microsecond),
+			percent(entry.Self, total),
+			entry.Total.Round(time.Microsecond),
+			percent(entry.Total, total),
+			entry.Label,
+		)
+	}
+	fmt.Fprintf(out, "\n%10v %12v %7v\n", "line", "self", "self%")
+	for _, line := range p.topLines(count) {
+		fmt.Fprintf(out, "%10d %12v %6.1f%%\n", line, p.lines[line].Round(time.Microsecond), percent(p.lines[line], total))
+	}
+}
+
+func percent(part, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
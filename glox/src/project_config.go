@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Looked up in this order in each directory from the script's one up to the root
+var projectConfigNames = []string{".gloxrc", "lox.json"}
+
+// Defaults of a repository, both `.gloxrc` and `lox.json` are JSON
+//
+//	{
+//		"extras": true,
+//		"enable": ["ternary", "arrays"],
+//		"disable": ["ImplicitStringCast"],
+//		"warnings": "warning"
+//	}
+type ProjectConfig struct {
+	// `nil` when the file doesn't set it, extras are enabled by default
+	Extras   *bool    `json:"extras"`
+	Enable   []string `json:"enable"`
+	Disable  []string `json:"disable"`
+	Warnings string   `json:"warnings"`
+	path     string
+}
+
+// Comma separated feature names, the flag can be repeated
+type featureList []string
+
+func (l *featureList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *featureList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := FindConfigFeature(name); err != nil {
+			return err
+		}
+		*l = append(*l, name)
+	}
+	return nil
+}
+
+// Walks up from [dir] and returns `nil` if no project file is found
+func FindProjectConfig(dir string) (*ProjectConfig, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			bytes, err := os.ReadFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			return ParseProjectConfig(path, bytes)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func ParseProjectConfig(path string, bytes []byte) (*ProjectConfig, error) {
+	config := &ProjectConfig{path: path}
+	err := json.Unmarshal(bytes, config)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid project file '%s': %w.", path, err)
+	}
+	return config, nil
+}
+
+// Applies the project defaults to [config]
+func (p *ProjectConfig) apply(config *Config) error {
+	if p.Extras != nil && !*p.Extras {
+		*config = BasicConfig
+	}
+	for _, name := range p.Enable {
+		if err := config.Set(name, true); err != nil {
+			return fmt.Errorf("Invalid project file '%s': %w", p.path, err)
+		}
+	}
+	for _, name := range p.Disable {
+		if err := config.Set(name, false); err != nil {
+			return fmt.Errorf("Invalid project file '%s': %w", p.path, err)
+		}
+	}
+	if p.Warnings != "" {
+		level, err := ParseWarningLevel(p.Warnings)
+		if err != nil {
+			return fmt.Errorf("Invalid project file '%s': %w", p.path, err)
+		}
+		config.Warnings = level
+	}
+	return nil
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const replHelp = `Meta-commands:
+  :tokens <src>          print the tokens produced by the scanner
+  :ast <src>             print the syntax tree produced by the parser
+  :env                   list the global variables and their values
+  :load <file>           execute a file into the current session
+  :reset                 start over with a fresh interpreter
+  :config [name [on|off]] show or toggle a language feature
+  :time <src>            execute and report wall time and allocations
+  :session [name]        show the session or join the shared one called [name]
+  :interrupt             abort the command running in the session, even another client's
+  :help                  show this message`
+
+// Interpreter state of a REPL, named sessions are shared between all the REPLs joining them
+type Session struct {
+	name        string
+	mu          sync.Mutex
+	interpreter *Interpreter
+}
+
+func NewSession(name string) *Session {
+	session := &Session{
+		name: name,
+	}
+	session.setInterpreter(NewInterpreter())
+	return session
+}
+
+// Commands running in a shared session release it between statements so the other clients can inspect and
+// patch the state meanwhile, they run at the top level whatever the function the command is in
+func (s *Session) setInterpreter(interpreter *Interpreter) {
+	s.interpreter = interpreter
+	if s.name == "" {
+		return
+	}
+	interpreter.yield = func() {
+		env, stdout, stderr := interpreter.enviroment, interpreter.stdout, interpreter.stderr
+		for interpreter.enviroment.enclosing != nil {
+			interpreter.enviroment = interpreter.enviroment.enclosing
+		}
+		s.mu.Unlock()
+		s.mu.Lock()
+		interpreter.enviroment, interpreter.stdout, interpreter.stderr = env, stdout, stderr
+	}
+}
+
+// Shared sessions by name, created the first time they are joined
+type Sessions struct {
+	mu     sync.Mutex
+	shared map[string]*Session
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{
+		shared: map[string]*Session{},
+	}
+}
+
+func (s *Sessions) get(name string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.shared[name]
+	if !ok {
+		session = NewSession(name)
+		s.shared[name] = session
+	}
+	return session
+}
+
+type Repl struct {
+	session  *Session
+	sessions *Sessions
+	reader   *bufio.Reader
+	out      io.Writer
+	err      io.Writer
+	// Set while a command is executing so SIGINT only aborts it
+	running atomic.Pointer[Interpreter]
+	// `true` after a SIGINT at the prompt, a second one exits
+	isExitPending atomic.Bool
+}
+
+func NewRepl(in io.Reader, out, err io.Writer, sessions *Sessions) *Repl {
+	return &Repl{
+		session:  NewSession(""),
+		sessions: sessions,
+		reader:   bufio.NewReader(in),
+		out:      out,
+		err:      err,
+	}
+}
+
+func replCommand(args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox repl [flags] [script]")
+		flags.PrintDefaults()
+	}
+	listen := flags.String("listen", "", "serve sessions on `address`, either unix:<path> or tcp:<host:port>")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	err = setupConfig(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	sessions := NewSessions()
+	if *listen == "" {
+		repl := NewRepl(os.Stdin, os.Stdout, os.Stderr, sessions)
+		if flags.NArg() == 1 {
+			err = repl.load(flags.Arg(0))
+			if err != nil {
+				return err
+			}
+		}
+		return repl.run()
+	}
+
+	listener, err := listenRepl(*listen)
+	if err != nil {
+		return err
+	}
+	// The script runs in the `main` session alongside the server so the clients joining it can attach while it runs
+	if flags.NArg() == 1 {
+		bytes, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		repl := NewRepl(strings.NewReader(""), os.Stdout, os.Stderr, sessions)
+		repl.session = sessions.get("main")
+		go repl.execute(string(bytes), false)
+	}
+	return serveRepl(listener, sessions)
+}
+
+func listenRepl(address string) (net.Listener, error) {
+	network, addr, ok := strings.Cut(address, ":")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("Invalid address '%s', expect unix:<path> or tcp:<host:port>.", address)
+	}
+	return net.Listen(network, addr)
+}
+
+// Every connection gets its own REPL with a private session until it joins a shared one
+func serveRepl(listener net.Listener, sessions *Sessions) error {
+
+	// Closing the listener also removes the unix socket file
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving REPL sessions on %v:%v\n", listener.Addr().Network(), listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = NewRepl(conn, conn, conn, sessions).loop()
+		}()
+	}
+}
+
+// Interactive loop on the terminal, SIGINT aborts the running command instead of exiting
+func (repl *Repl) run() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	go repl.handleInterrupts(signals)
+
+	return repl.loop()
+}
+
+func (repl *Repl) loop() error {
+	lines := make(chan string)
+	errs := make(chan error, 1)
+	go repl.readLines(lines, errs)
+
+	for {
+		fmt.Fprint(repl.out, "> ")
+		line, ok := <-lines
+		if !ok {
+			return <-errs
+		}
+		repl.isExitPending.Store(false)
+
+		if command, ok := strings.CutPrefix(strings.TrimSpace(line), ":"); ok {
+			err := repl.metaCommand(command)
+			if err != nil {
+				fmt.Fprintln(repl.err, err)
+			}
+			continue
+		}
+		repl.execute(line, true)
+	}
+}
+
+// Reads ahead of the loop so `:interrupt` can abort the command this REPL is running
+func (repl *Repl) readLines(lines chan<- string, errs chan<- error) {
+	defer close(lines)
+	for {
+		line, err := repl.reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			errs <- nil
+			return
+		} else if err != nil {
+			errs <- err
+			return
+		}
+
+		if interpreter := repl.running.Load(); interpreter != nil && strings.TrimSpace(line) == ":interrupt" {
+			interpreter.Interrupt()
+			continue
+		}
+		lines <- line
+	}
+}
+
+// Runs [source] in the session, a SIGINT or `:interrupt` meanwhile aborts it leaving the globals untouched
+func (repl *Repl) execute(source string, isReplMode bool) {
+	repl.session.mu.Lock()
+	defer repl.session.mu.Unlock()
+
+	interpreter := repl.session.interpreter.WithOutput(repl.out, repl.err)
+	interpreter.ClearInterrupt()
+	repl.running.Store(interpreter)
+	defer repl.running.Store(nil)
+
+	_ = run(source, interpreter, isReplMode)
+}
+
+func (repl *Repl) handleInterrupts(signals <-chan os.Signal) {
+	for range signals {
+		if interpreter := repl.running.Load(); interpreter != nil {
+			interpreter.Interrupt()
+		} else if repl.isExitPending.Swap(true) {
+			fmt.Fprintln(repl.out)
+			os.Exit(0)
+		} else {
+			fmt.Fprint(repl.out, "\n(To exit, press Ctrl-C again)\n> ")
+		}
+	}
+}
+
+func (repl *Repl) metaCommand(command string) error {
+	name, arg, _ := strings.Cut(command, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "tokens":
+		return repl.printTokens(arg)
+	case "ast":
+		return repl.printAst(arg)
+	case "env":
+		repl.printEnv()
+		return nil
+	case "load":
+		return repl.load(arg)
+	case "reset":
+		repl.reset()
+		return nil
+	case "config":
+		return repl.config(arg)
+	case "time":
+		return repl.time(arg)
+	case "session":
+		repl.joinSession(arg)
+		return nil
+	case "interrupt":
+		repl.interrupt()
+		return nil
+	case "help":
+		fmt.Fprintln(repl.out, replHelp)
+		return nil
+	default:
+		return fmt.Errorf("Unknown command ':%s', use ':help' to list them.", name)
+	}
+}
+
+// Copied as another client of a shared session could toggle it meanwhile
+func (repl *Repl) sessionConfig() *Config {
+	repl.session.mu.Lock()
+	defer repl.session.mu.Unlock()
+	config := *repl.session.interpreter.config
+	return &config
+}
+
+func (repl *Repl) printTokens(source string) error {
+	scanner := NewScanner(source, repl.sessionConfig(), NewErrorReporter(repl.err))
+	err := scanner.scanTokens()
+	for _, token := range scanner.Tokens {
+		fmt.Fprintf(repl.out, "[line %v] %v\n", token.Line, token)
+	}
+	return err
+}
+
+func (repl *Repl) printAst(source string) error {
+	config := repl.sessionConfig()
+	reporter := NewErrorReporter(repl.err)
+	scanner := NewScanner(source, config, reporter)
+	err := scanner.scanTokens()
+	if err != nil {
+		return err
+	}
+
+	stmts, err := NewParser(scanner.Tokens, config, reporter).WithReplMode(true).parse()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(repl.out, NewAstPrinter().printStmts(stmts))
+	return nil
+}
+
+func (repl *Repl) printEnv() {
+	repl.session.mu.Lock()
+	defer repl.session.mu.Unlock()
+	globals := repl.session.interpreter.globals
+
+	names := []string{}
+	for name := range globals {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value := globals[name]
+		if isOfType[Uninitialized](value) {
+			fmt.Fprintf(repl.out, "%v = <uninitialized>\n", name)
+		} else {
+			fmt.Fprintf(repl.out, "%v = %s\n", name, stringify(value))
+		}
+	}
+}
+
+// The file is executed as a script so a missing `;` is an error as it would be with `glox [script]`
+func (repl *Repl) load(filePath string) error {
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	repl.execute(string(bytes), false)
+	return nil
+}
+
+// Features toggled in the session are kept
+func (repl *Repl) reset() {
+	repl.session.mu.Lock()
+	defer repl.session.mu.Unlock()
+	interpreter := NewInterpreter()
+	*interpreter.config = *repl.session.interpreter.config
+	repl.session.setInterpreter(interpreter)
+}
+
+// Another client's command, this REPL's own one is aborted as soon as `:interrupt` is read
+func (repl *Repl) interrupt() {
+	repl.session.mu.Lock()
+	defer repl.session.mu.Unlock()
+	repl.session.interpreter.Interrupt()
+}
+
+func (repl *Repl) config(arg string) error {
+	config := repl.sessionConfig()
+	args := strings.Fields(arg)
+	switch len(args) {
+	case 0:
+		for i := range ConfigFeatures {
+			fmt.Fprintf(repl.out, "%-22v %v\n", ConfigFeatures[i].Name, onOff(config.IsEnabled(&ConfigFeatures[i])))
+		}
+		return nil
+	case 1:
+		feature, err := FindConfigFeature(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(repl.out, "%v %v\n", feature.Name, onOff(config.IsEnabled(feature)))
+		return nil
+	case 2:
+		repl.session.mu.Lock()
+		defer repl.session.mu.Unlock()
+		switch args[1] {
+		case "on", "true", "enable":
+			return repl.session.interpreter.config.Set(args[0], true)
+		case "off", "false", "disable":
+			return repl.session.interpreter.config.Set(args[0], false)
+		}
+		return fmt.Errorf("Expect 'on' or 'off' after feature name.")
+	default:
+		return fmt.Errorf("Usage: :config [name [on|off]]")
+	}
+}
+
+func (repl *Repl) time(source string) error {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	repl.execute(source, true)
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	fmt.Fprintf(repl.err, "%v, %d allocations, %d bytes\n",
+		elapsed, after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc)
+	return nil
+}
+
+func (repl *Repl) joinSession(name string) {
+	if name != "" {
+		repl.session = repl.sessions.get(name)
+	}
+	if repl.session.name == "" {
+		fmt.Fprintln(repl.out, "private session")
+	} else {
+		fmt.Fprintf(repl.out, "shared session '%v'\n", repl.session.name)
+	}
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
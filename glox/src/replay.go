@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Boundary of the natives reading the outside world, see [ProtoCallable.WithInput]
+// A run either records what they return or replays a recording instead of calling them.
+// `clock()` is the only such native for now, glox has no natives reading stdin, files,
+// the environment or random numbers
+type InputSource interface {
+	input(native string, read func() (any, error)) (any, error)
+}
+
+// First line of a recording, the replay refuses to run another script
+type inputLogHeader struct {
+	Script string `json:"script"`
+	Sha256 string `json:"sha256"`
+}
+
+// A result of a native as a JSON line, at most one of the values is set and none for `nil`
+type recordedInput struct {
+	Native string   `json:"native"`
+	Number *float64 `json:"number,omitempty"`
+	String *string  `json:"string,omitempty"`
+	Bool   *bool    `json:"bool,omitempty"`
+	// Failures of the native are replayed too
+	Error *string `json:"error,omitempty"`
+}
+
+func newRecordedInput(native string, value any, err error) (*recordedInput, error) {
+	input := &recordedInput{Native: native}
+	if err != nil {
+		message := err.Error()
+		input.Error = &message
+		return input, nil
+	}
+	switch value := value.(type) {
+	case nil:
+	case float64:
+		input.Number = &value
+	case []byte:
+		text := string(value)
+		input.String = &text
+	case bool:
+		input.Bool = &value
+	default:
+		return nil, fmt.Errorf("Can't record the %T returned by '%v'.", value, native)
+	}
+	return input, nil
+}
+
+func (r *recordedInput) value() (any, error) {
+	switch {
+	case r.Error != nil:
+		return nil, errors.New(*r.Error)
+	case r.Number != nil:
+		return *r.Number, nil
+	case r.String != nil:
+		return []byte(*r.String), nil
+	case r.Bool != nil:
+		return *r.Bool, nil
+	}
+	return nil, nil
+}
+
+func sourceHash(source []byte) string {
+	hash := sha256.Sum256(source)
+	return hex.EncodeToString(hash[:])
+}
+
+// Writes each input as soon as it is read so a crash keeps the inputs leading to it
+type InputRecorder struct {
+	encoder *json.Encoder
+}
+
+func NewInputRecorder(out io.Writer, script string, source []byte) (*InputRecorder, error) {
+	encoder := json.NewEncoder(out)
+	err := encoder.Encode(inputLogHeader{Script: script, Sha256: sourceHash(source)})
+	if err != nil {
+		return nil, err
+	}
+	return &InputRecorder{encoder: encoder}, nil
+}
+
+func (r *InputRecorder) input(native string, read func() (any, error)) (any, error) {
+	value, err := read()
+	input, recordErr := newRecordedInput(native, value, err)
+	if recordErr != nil {
+		return nil, recordErr
+	}
+	recordErr = r.encoder.Encode(input)
+	if recordErr != nil {
+		return nil, recordErr
+	}
+	return value, err
+}
+
+// Returns the recorded inputs in order, the natives are never called
+type InputReplayer struct {
+	inputs []*recordedInput
+	next   int
+}
+
+func NewInputReplayer(in io.Reader, script string, source []byte) (*InputReplayer, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16*1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("Empty recording, expect a header line.")
+	}
+	var header inputLogHeader
+	err := json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid recording header: %v.", err)
+	}
+	if header.Sha256 != sourceHash(source) {
+		return nil, fmt.Errorf("'%v' changed since '%v' was recorded, the replay would diverge.", script, header.Script)
+	}
+
+	replayer := &InputReplayer{}
+	for line := 2; scanner.Scan(); line++ {
+		input := &recordedInput{}
+		err = json.Unmarshal(scanner.Bytes(), input)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recording at line %d: %v.", line, err)
+		}
+		replayer.inputs = append(replayer.inputs, input)
+	}
+	return replayer, scanner.Err()
+}
+
+func (r *InputReplayer) input(native string, read func() (any, error)) (any, error) {
+	if r.next >= len(r.inputs) {
+		return nil, fmt.Errorf("Replay diverged: '%v' was called after the last recorded input.", native)
+	}
+	input := r.inputs[r.next]
+	if input.Native != native {
+		return nil, fmt.Errorf("Replay diverged: '%v' was called where the recording has '%v'.", native, input.Native)
+	}
+	r.next++
+	return input.value()
+}
+
+// Inputs left when the script ended, a sign it took another path than when recorded
+func (r *InputReplayer) remaining() int {
+	return len(r.inputs) - r.next
+}
+
+// Records the inputs of the script to [record] or replays them from [replay],
+// [finish] closes the recording and warns about the inputs the replay didn't use
+func attachInputs(interpreter *Interpreter, script, record, replay string) (finish func(), err error) {
+	source, err := os.ReadFile(script)
+	if err != nil {
+		return nil, err
+	}
+	if record != "" {
+		file, err := os.Create(record)
+		if err != nil {
+			return nil, err
+		}
+		recorder, err := NewInputRecorder(file, script, source)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		interpreter.inputs = recorder
+		return func() { file.Close() }, nil
+	}
+
+	file, err := os.Open(replay)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	replayer, err := NewInputReplayer(file, script, source)
+	if err != nil {
+		return nil, err
+	}
+	interpreter.inputs = replayer
+	return func() {
+		if remaining := replayer.remaining(); remaining > 0 {
+			fmt.Fprintf(interpreter.stderr, "Warning: %d recorded inputs were not replayed.\n", remaining)
+		}
+	}, nil
+}
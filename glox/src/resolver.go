@@ -1,5 +1,7 @@
 package main
 
+import "slices"
+
 type FunctionType int
 
 const (
@@ -19,9 +21,125 @@ const (
 
 type Resolver struct {
 	interpreter     *Interpreter
+	config          *Config
+	reporter        *ErrorReporter
 	scopes          *Scopes
 	currentFunction FunctionType
 	currentClass    ClassType
+	// `nil` unless the bindings are needed, e.g. by the language server
+	bindings *Bindings
+}
+
+// The declaration each variable use refers to, as found by the resolver
+type Bindings struct {
+	// Local declarations and uses
+	locals map[*Token]*Token
+	// First declaration of each global
+	globals map[string]*Token
+	// Globals can be used before being declared, e.g. in a function body, so they are looked up when asked
+	globalTokens map[*Token]bool
+	// What each declaration is
+	infos map[*Token]*BindingInfo
+	// Node scoping each local declaration
+	scopes map[*Token]any
+}
+
+type BindingKind int
+
+const (
+	BindingVariable BindingKind = iota
+	BindingParameter
+	BindingFunction
+	BindingClass
+)
+
+type BindingInfo struct {
+	Kind BindingKind
+	// Set for functions
+	Function *ExprFunction
+	// Set for classes
+	Class *StmtClass
+}
+
+func NewBindings() *Bindings {
+	return &Bindings{
+		locals:       map[*Token]*Token{},
+		globals:      map[string]*Token{},
+		globalTokens: map[*Token]bool{},
+		infos:        map[*Token]*BindingInfo{},
+		scopes:       map[*Token]any{},
+	}
+}
+
+// Returns `nil` for tokens that aren't declarations
+func (b *Bindings) Info(declaration *Token) *BindingInfo {
+	return b.infos[declaration]
+}
+
+// Every declaration, globals included, in source order
+func (b *Bindings) Declarations() []*Token {
+	declarations := []*Token{}
+	for declaration := range b.infos {
+		declarations = append(declarations, declaration)
+	}
+	slices.SortFunc(declarations, func(a, b *Token) int {
+		return a.Offset - b.Offset
+	})
+	return declarations
+}
+
+// The *StmtBlock or *ExprFunction where the local [declaration] is visible, `nil` for globals
+func (b *Bindings) Scope(declaration *Token) any {
+	return b.scopes[declaration]
+}
+
+// Returns `nil` for natives, undefined globals and tokens that aren't variables
+func (b *Bindings) Declaration(token *Token) *Token {
+	if declaration, ok := b.locals[token]; ok {
+		return declaration
+	}
+	if b.globalTokens[token] {
+		return b.globals[token.Lexeme]
+	}
+	return nil
+}
+
+// Every declaration and use bound to [declaration], in source order
+func (b *Bindings) References(declaration *Token) []*Token {
+	references := []*Token{}
+	for token := range b.locals {
+		if b.locals[token] == declaration {
+			references = append(references, token)
+		}
+	}
+	for token := range b.globalTokens {
+		if b.globals[token.Lexeme] == declaration {
+			references = append(references, token)
+		}
+	}
+	slices.SortFunc(references, func(a, b *Token) int {
+		return a.Offset - b.Offset
+	})
+	return references
+}
+
+func (b *Bindings) declare(name *Token, isGlobal bool) {
+	if !isGlobal {
+		b.locals[name] = name
+		return
+	}
+	if _, ok := b.globals[name.Lexeme]; !ok {
+		b.globals[name.Lexeme] = name
+	}
+	b.globalTokens[name] = true
+}
+
+func (b *Bindings) bind(use *Token, declaration *Token) {
+	// `this` and `super` are declared by the resolver itself
+	if declaration.Line == 0 {
+		return
+	}
+	b.locals[use] = declaration
 }
 
 type Scopes []*Scope
@@ -30,6 +148,8 @@ type Scope struct {
 	variables       map[string]*LocalVariable
 	currentIndex    int
 	unusedVariables map[*Token]bool
+	// Variable names by slot, the environments created at runtime follow the same order
+	names []string
 }
 
 type LocalVariable struct {
@@ -55,6 +175,7 @@ func (s *Scope) NewLocalVariable(declaration *Token) {
 		declaration: declaration,
 		scopedIndex: s.currentIndex,
 	}
+	s.names = append(s.names, declaration.Lexeme)
 	s.currentIndex++
 }
 
@@ -74,15 +195,22 @@ func (s *Scopes) isEmpty() bool {
 	return len(*s) == 0
 }
 
-func NewResolver(interpreter *Interpreter) *Resolver {
+func NewResolver(interpreter *Interpreter, config *Config, reporter *ErrorReporter) *Resolver {
 	return &Resolver{
 		interpreter:     interpreter,
+		config:          config,
+		reporter:        reporter,
 		scopes:          NewScopes(),
 		currentFunction: FunctionTypeNone,
 		currentClass:    ClassTypeNone,
 	}
 }
 
+func (resolver *Resolver) WithBindings(bindings *Bindings) *Resolver {
+	resolver.bindings = bindings
+	return resolver
+}
+
 func (resolver *Resolver) resolveStmts(stmts []Stmt) error {
 	for _, stmt := range stmts {
 		resolver.resolveStmt(stmt)
@@ -102,6 +230,8 @@ func (resolver *Resolver) resolveExpr(expr Expr) error {
 func (resolver *Resolver) visitBlockStmt(stmt *StmtBlock) error {
 	resolver.beginScope()
 	resolver.resolveStmts(stmt.block)
+	resolver.interpreter.resolveScope(stmt, resolver.scopes.peek().names)
+	resolver.bindScope(stmt)
 	resolver.endScope()
 	return nil
 }
@@ -112,11 +242,12 @@ func (resolver *Resolver) visitClassStmt(stmt *StmtClass) error {
 
 	resolver.declare(stmt.name)
 	resolver.define(stmt.name)
+	resolver.describe(stmt.name, &BindingInfo{Kind: BindingClass, Class: stmt})
 
 	if stmt.superclass != nil {
 		resolver.currentClass = ClassTypeSubclass
 		if stmt.name.Lexeme == stmt.superclass.name.Lexeme {
-			printError(stmt.superclass.name, "A class can't inherit from itself.")
+			resolver.reporter.printError(stmt.superclass.name, "A class can't inherit from itself.")
 		}
 
 		err := resolver.resolveExpr(stmt.superclass)
@@ -162,25 +293,55 @@ func (resolver *Resolver) beginScope() {
 }
 
 func (resolver *Resolver) endScope() {
-	if GlobalConfig.ForbidUnusedVariable {
+	if resolver.config.ForbidUnusedVariable {
 		for varDeclaration := range resolver.scopes.peek().unusedVariables {
-			printError(varDeclaration, "Variable declared but never read")
+			resolver.warn(varDeclaration, "Variable declared but never read")
 		}
 	}
 	resolver.scopes.pop()
 }
 
+// Reports checks that don't prevent execution with the level of [Config.Warnings]
+func (resolver *Resolver) warn(token *Token, message string) {
+	switch resolver.config.Warnings {
+	case WarningsAsErrors:
+		resolver.reporter.printError(token, message)
+	case WarningsShown:
+		resolver.reporter.printWarning(token, message)
+	}
+}
+
+// Records [node] as the scope of the variables of the current scope when the bindings are kept
+func (resolver *Resolver) bindScope(node any) {
+	if resolver.bindings == nil {
+		return
+	}
+	for _, variable := range resolver.scopes.peek().variables {
+		resolver.bindings.scopes[variable.declaration] = node
+	}
+}
+
+// Records what [name] declares when the bindings are kept
+func (resolver *Resolver) describe(name *Token, info *BindingInfo) {
+	if resolver.bindings != nil {
+		resolver.bindings.infos[name] = info
+	}
+}
+
 func (resolver *Resolver) declare(name *Token) {
+	if resolver.bindings != nil {
+		resolver.bindings.declare(name, resolver.scopes.isEmpty())
+	}
 	if resolver.scopes.isEmpty() {
 		return
 	}
 	scope := resolver.scopes.peek()
 	if _, ok := scope.variables[name.Lexeme]; ok {
-		printError(name, "Already a variable with this name in this scope.")
+		resolver.reporter.printError(name, "Already a variable with this name in this scope.")
 	}
 
 	scope.NewLocalVariable(name)
-	if GlobalConfig.ForbidUnusedVariable {
+	if resolver.config.ForbidUnusedVariable {
 		scope.unusedVariables[name] = true
 	}
 }
@@ -201,8 +362,25 @@ func (resolver *Resolver) visitContinueStmt(stmt *StmtContinue) error {
 	return nil
 }
 
+func (resolver *Resolver) visitAssertStmt(stmt *StmtAssert) error {
+	resolver.resolveExpr(stmt.condition)
+	if stmt.message != nil {
+		resolver.resolveExpr(stmt.message)
+	}
+	return nil
+}
+
+// Tests are run one by one after the script, only the global scope is left by then
+func (resolver *Resolver) visitTestStmt(stmt *StmtTest) error {
+	if !resolver.scopes.isEmpty() || resolver.currentFunction != FunctionTypeNone {
+		resolver.reporter.printError(stmt.keyword, "Can't declare a test outside of the top-level code.")
+	}
+	return stmt.body.accept(resolver)
+}
+
 func (resolver *Resolver) visitVarStmt(stmt *StmtVar) (err error) {
 	resolver.declare(stmt.name)
+	resolver.describe(stmt.name, &BindingInfo{Kind: BindingVariable})
 	if stmt.initializer != nil {
 		resolver.resolveExpr(stmt.initializer)
 	}
@@ -223,6 +401,7 @@ func (resolver *Resolver) visitExpressionStmt(stmt *StmtExpression) error {
 func (resolver *Resolver) visitFunctionStmt(stmt *StmtFunction) error {
 	resolver.declare(stmt.name)
 	resolver.define(stmt.name)
+	resolver.describe(stmt.name, &BindingInfo{Kind: BindingFunction, Function: stmt.function})
 	resolver.resolveFunction(stmt.function, FunctionTypeFunc)
 	return nil
 }
@@ -251,11 +430,11 @@ func (resolver *Resolver) visitPrintStmt(stmt *StmtPrint) error {
 
 func (resolver *Resolver) visitReturnStmt(stmt *StmtReturn) (err error) {
 	if resolver.currentFunction == FunctionTypeNone {
-		printError(stmt.keyword, "Can't return from top-level code.")
+		resolver.reporter.printError(stmt.keyword, "Can't return from top-level code.")
 	}
 	if stmt.expression != nil {
 		if resolver.currentFunction == FunctionTypeInitializer {
-			printError(stmt.keyword, "Can't return a value from an initializer.")
+			resolver.reporter.printError(stmt.keyword, "Can't return a value from an initializer.")
 		}
 		resolver.resolveExpr(stmt.expression)
 	}
@@ -337,9 +516,9 @@ func (resolver *Resolver) visitArrayInstanceExpr(expr *ExprArrayInstance) (any,
 
 func (resolver *Resolver) visitSuperExpr(expr *ExprSuper) (any, error) {
 	if resolver.currentClass == ClassTypeNone {
-		printError(expr.keyword, "Can't use 'super' outside of a class.")
+		resolver.reporter.printError(expr.keyword, "Can't use 'super' outside of a class.")
 	} else if resolver.currentClass != ClassTypeSubclass {
-		printError(expr.keyword, "Can't use 'super' in a class with no superclass.")
+		resolver.reporter.printError(expr.keyword, "Can't use 'super' in a class with no superclass.")
 	}
 	resolver.resolveLocal(expr, expr.keyword, true)
 	return nil, nil
@@ -347,7 +526,7 @@ func (resolver *Resolver) visitSuperExpr(expr *ExprSuper) (any, error) {
 
 func (resolver *Resolver) visitThisExpr(expr *ExprThis) (any, error) {
 	if resolver.currentClass == ClassTypeNone {
-		printError(expr.keyword, "Can't use 'this' outside of a class.")
+		resolver.reporter.printError(expr.keyword, "Can't use 'this' outside of a class.")
 		return nil, nil
 	}
 	resolver.resolveLocal(expr, expr.keyword, true)
@@ -362,7 +541,7 @@ func (resolver *Resolver) visitUnaryExpr(expr *ExprUnary) (any, error) {
 func (resolver *Resolver) visitVariableExpr(expr *ExprVariable) (any, error) {
 	if !resolver.scopes.isEmpty() {
 		if localVar, ok := resolver.scopes.peek().variables[expr.name.Lexeme]; ok && !localVar.isInitialized {
-			printError(expr.name, "Can't read local variable in its own initializer.")
+			resolver.reporter.printError(expr.name, "Can't read local variable in its own initializer.")
 		}
 	}
 	resolver.resolveLocal(expr, expr.name, true)
@@ -372,13 +551,19 @@ func (resolver *Resolver) visitVariableExpr(expr *ExprVariable) (any, error) {
 func (resolver *Resolver) resolveLocal(expr Expr, name *Token, isRead bool) {
 	for i := len(*resolver.scopes) - 1; i >= 0; i-- {
 		if localVar, ok := (*resolver.scopes)[i].variables[name.Lexeme]; ok {
-			if isRead && GlobalConfig.ForbidUnusedVariable {
+			if isRead && resolver.config.ForbidUnusedVariable {
 				delete((*resolver.scopes)[i].unusedVariables, localVar.declaration)
 			}
 			resolver.interpreter.resolve(expr, len(*resolver.scopes)-1-i, localVar.scopedIndex)
+			if resolver.bindings != nil {
+				resolver.bindings.bind(name, localVar.declaration)
+			}
 			return
 		}
 	}
+	if resolver.bindings != nil {
+		resolver.bindings.globalTokens[name] = true
+	}
 }
 
 func (resolver *Resolver) resolveFunction(expr *ExprFunction, funcType FunctionType) {
@@ -389,8 +574,11 @@ func (resolver *Resolver) resolveFunction(expr *ExprFunction, funcType FunctionT
 	for _, param := range expr.params {
 		resolver.declare(param)
 		resolver.define(param)
+		resolver.describe(param, &BindingInfo{Kind: BindingParameter})
 	}
 	resolver.resolveStmts(expr.body)
+	resolver.interpreter.resolveScope(expr, resolver.scopes.peek().names)
+	resolver.bindScope(expr)
 	resolver.endScope()
 
 	resolver.currentFunction = enclosingFunction
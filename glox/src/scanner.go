@@ -2,16 +2,37 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"strconv"
+	"strings"
 )
 
+type ScanError struct {
+	line    int
+	message string
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("[line %v] Error: %v", e.line, e.message)
+}
+
 type Scanner struct {
 	Source   string
 	Tokens   []*Token
 	keywords map[string]TokenType
+	config   *Config
+	reporter *ErrorReporter
 	start    int
 	current  int
 	line     int
+	// When `true` comments, whitespace and unscannable text are kept as trivia of the tokens
+	isLossless bool
+	// Leading trivia of the next token
+	trivia []Trivia
+	// End of the source already stored in a token or in a trivia
+	covered int
+	// `true` until a newline follows the last token, meanwhile trivia are trailing
+	isOnTokenLine bool
 }
 
 var defaultKeywords = map[string]TokenType{
@@ -34,27 +55,32 @@ var defaultKeywords = map[string]TokenType{
 	"break":  Break,
 }
 
-func NewScanner(source string) Scanner {
-	keywords := defaultKeywords
-	if GlobalConfig.AllowContinueKeyword {
+func NewScanner(source string, config *Config, reporter *ErrorReporter) *Scanner {
+	// Cloned so toggling the config doesn't leak keywords into later scanners
+	keywords := maps.Clone(defaultKeywords)
+	if config.AllowContinueKeyword {
 		keywords["continue"] = Continue
 	}
-	if GlobalConfig.AllowTernaryOperator {
-		keywords["?"] = QuestionMark
-		keywords[":"] = Colon
-	}
-	if GlobalConfig.AllowArrays {
+	if config.AllowArrays {
 		keywords["Array"] = Array
 	}
 
-	return Scanner{
+	return &Scanner{
 		Source:   source,
 		Tokens:   []*Token{},
 		keywords: keywords,
+		config:   config,
+		reporter: reporter,
 		line:     1,
 	}
 }
 
+// In lossless mode the source can be reproduced byte for byte from the tokens, see [TokensSource]
+func (scanner *Scanner) WithLossless() *Scanner {
+	scanner.isLossless = true
+	return scanner
+}
+
 func (scanner *Scanner) scanTokens() (err error) {
 	for !scanner.isAtEnd() {
 		scanner.start = scanner.current
@@ -62,13 +88,19 @@ func (scanner *Scanner) scanTokens() (err error) {
 		if tokenErr != nil {
 			err = tokenErr
 		}
+		if scanner.isLossless && scanner.covered < scanner.current {
+			// Unexpected characters and unterminated strings
+			scanner.addTrivia(TriviaSkipped)
+		}
 	}
 
 	scanner.Tokens = append(scanner.Tokens, &Token{
-		Type:    EOF,
-		Lexeme:  "",
-		Literal: nil,
-		Line:    scanner.line,
+		Type:          EOF,
+		Lexeme:        "",
+		Literal:       nil,
+		Line:          scanner.line,
+		Offset:        len(scanner.Source),
+		LeadingTrivia: scanner.trivia,
 	})
 	return err
 }
@@ -129,42 +161,47 @@ func (scanner *Scanner) scanToken() (err error) {
 			for char, err := scanner.peek(); err == nil && char != '\n'; char, err = scanner.peek() {
 				scanner.advance()
 			}
+			scanner.addTrivia(TriviaLineComment)
 		} else if scanner.match('*') {
-			scanner.blockComment()
+			err = scanner.blockComment()
+			if err == nil {
+				scanner.addTrivia(TriviaBlockComment)
+			}
 		} else {
 			scanner.addToken(Slash)
 		}
 	case '"':
 		err = scanner.stringLiteral()
-	case '?':
-		scanner.addToken(QuestionMark)
-	case ':':
-		scanner.addToken(Colon)
-	case ' ':
-	case '\r':
-	case '\t':
+	case ' ', '\r', '\t':
+		scanner.addTrivia(TriviaWhitespace)
 	case '\n':
 		scanner.line++
+		scanner.addTrivia(TriviaNewline)
 	default:
 		if IsDigit(c) {
 			err = scanner.numberLiteral()
 		} else if IsAlpha(c) {
 			err = scanner.identifier()
-		} else if c == '%' && GlobalConfig.AllowModuloOperator {
+		} else if c == '?' && scanner.config.AllowTernaryOperator {
+			scanner.addToken(QuestionMark)
+		} else if c == ':' && scanner.config.AllowTernaryOperator {
+			scanner.addToken(Colon)
+		} else if c == '%' && scanner.config.AllowModuloOperator {
 			scanner.addToken(Percent)
-		} else if c == '[' && GlobalConfig.AllowArrays {
+		} else if c == '[' && scanner.config.AllowArrays {
 			scanner.addToken(LeftBracket)
-		} else if c == ']' && GlobalConfig.AllowArrays {
+		} else if c == ']' && scanner.config.AllowArrays {
 			scanner.addToken(RightBracket)
 		} else {
-			report(scanner.line, "", "Unexpected character.")
+			scanner.reporter.report(scanner.line, "", "Unexpected character.")
 		}
 	}
 
 	if err != nil {
-		report(scanner.line, "", err.Error())
+		scanner.reporter.report(scanner.line, "", err.Error())
+		return &ScanError{line: scanner.line, message: err.Error()}
 	}
-	return err
+	return nil
 }
 
 func (scanner *Scanner) addToken(tokenType TokenType) {
@@ -260,43 +297,60 @@ func (scanner *Scanner) identifier() error {
 	return nil
 }
 
+// Block comments can be nested, the opening '/*' is already consumed
 func (scanner *Scanner) blockComment() error {
-	for char, err := scanner.peek(); err == nil; char, err = scanner.peek() {
-		if char == '*' {
-			nextChar, err := scanner.peekNext()
-			if err == nil && nextChar == '/' {
-				break
-			}
-		} else if char == '/' {
-			nextChar, err := scanner.peekNext()
-			if err == nil && nextChar == '*' {
-				scanner.advance()
-				scanner.advance()
-				scanner.blockComment()
-			}
-		} else {
-			if char == '\n' {
-				scanner.line++
+	for !scanner.isAtEnd() {
+		char := scanner.advance()
+		if char == '\n' {
+			scanner.line++
+		} else if char == '*' && scanner.match('/') {
+			return nil
+		} else if char == '/' && scanner.match('*') {
+			err := scanner.blockComment()
+			if err != nil {
+				return err
 			}
-			scanner.advance()
 		}
 	}
-	if scanner.isAtEnd() {
-		return fmt.Errorf("Unterminated block comment.")
+	return fmt.Errorf("Unterminated block comment.")
+}
+
+func (scanner *Scanner) addTrivia(kind TriviaKind) {
+	if !scanner.isLossless {
+		return
 	}
+	text := scanner.Source[scanner.covered:scanner.current]
+	scanner.covered = scanner.current
 
-	// Consuming the closing '*/'
-	scanner.advance()
-	scanner.advance()
+	trivia := &scanner.trivia
+	if scanner.isOnTokenLine {
+		trivia = &scanner.Tokens[len(scanner.Tokens)-1].TrailingTrivia
+		if strings.Contains(text, "\n") {
+			scanner.isOnTokenLine = false
+		}
+	}
 
-	return nil
+	// Consecutive spaces and tabs are merged in a single trivia
+	if last := len(*trivia) - 1; kind == TriviaWhitespace && last >= 0 && (*trivia)[last].Kind == TriviaWhitespace {
+		(*trivia)[last].Text += text
+		return
+	}
+	*trivia = append(*trivia, Trivia{Kind: kind, Text: text})
 }
 
 func (scanner *Scanner) addTokenWithLiteral(tokenType TokenType, literal any) {
-	scanner.Tokens = append(scanner.Tokens, &Token{
+	token := &Token{
 		Type:    tokenType,
 		Literal: literal,
 		Lexeme:  scanner.Source[scanner.start:scanner.current],
 		Line:    scanner.line,
-	})
+		Offset:  scanner.start,
+	}
+	if scanner.isLossless {
+		token.LeadingTrivia = scanner.trivia
+		scanner.trivia = nil
+		scanner.covered = scanner.current
+		scanner.isOnTokenLine = true
+	}
+	scanner.Tokens = append(scanner.Tokens, token)
 }
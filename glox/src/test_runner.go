@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var errTestFailures = errors.New("test failures")
+
+func testCommand(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox test [flags] [path ...]")
+		fmt.Fprintln(os.Stderr, "Runs the `test \"name\" { }` blocks and `test_*` functions of the *_test.lox files, each test in a fresh interpreter")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "text", "output `format`: text, tap or junit")
+	output := flags.String("o", "", "write the results to `file` instead of the standard output")
+	run := flags.String("run", "", "only run the tests whose name matches the `regexp`")
+	timeout := flags.Duration("timeout", 10*time.Second, "fail a test running longer than `duration`")
+	verbose := flags.Bool("v", false, "list the tests passing too, in the text format")
+	var reports runReports
+	flags.StringVar(&reports.coverage, "coverage", "", "write the statements and branches executed by the tests to `file` in the LCOV format")
+	flags.StringVar(&reports.coverageHTML, "coverage-html", "", "write the sources annotated with the coverage to `file` as a standalone HTML page")
+	addCommonFlags(flags)
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "tap" && *format != "junit" {
+		return fmt.Errorf("Unknown format '%v', expect text, tap or junit.", *format)
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("Invalid --run pattern: %v.", err)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No *_test.lox file found.")
+	}
+
+	runner := NewTestRunner(*timeout).WithFilter(filter)
+	if reports.coverage != "" || reports.coverageHTML != "" {
+		if *optimize {
+			return fmt.Errorf("Can't use -O with --coverage, the pruned branches would be missing.")
+		}
+		runner.coverage = NewCoverage()
+	}
+	for _, file := range files {
+		err = setupConfig(file)
+		if err != nil {
+			return err
+		}
+		runner.runFile(file)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	switch *format {
+	case "tap":
+		err = writeTap(out, runner.results)
+	case "junit":
+		err = writeJUnit(out, runner.results)
+	default:
+		err = writeTestText(out, runner.results, *verbose)
+	}
+	if err != nil {
+		return err
+	}
+
+	if runner.coverage != nil {
+		err = writeReport(reports.coverage, runner.coverage.writeLcov)
+		if err != nil {
+			return err
+		}
+		err = writeReport(reports.coverageHTML, runner.coverage.writeHTML)
+		if err != nil {
+			return err
+		}
+	}
+	for _, result := range runner.results {
+		if result.Err != nil {
+			return errTestFailures
+		}
+	}
+	return nil
+}
+
+// The *_test.lox files of the directories, files given explicitly are kept whatever their name
+func testFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && strings.HasSuffix(file, "_test.lox") {
+				files = append(files, file)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// A `test "name" { }` block or a `test_*` function without parameters, declared at the top level
+type TestCase struct {
+	Name     string
+	Line     int
+	block    *StmtBlock
+	function *StmtFunction
+}
+
+func findTests(stmts []Stmt) []*TestCase {
+	tests := []*TestCase{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *StmtTest:
+			name := strings.Trim(stmt.name.Lexeme, "\"")
+			tests = append(tests, &TestCase{Name: name, Line: stmt.keyword.Line, block: stmt.body})
+		case *StmtFunction:
+			if strings.HasPrefix(stmt.name.Lexeme, "test_") && len(stmt.function.params) == 0 && stmt.function.params != nil {
+				tests = append(tests, &TestCase{Name: stmt.name.Lexeme, Line: stmt.name.Line, function: stmt})
+			}
+		}
+	}
+	return tests
+}
+
+type TestResult struct {
+	File string
+	Name string
+	Line int
+	// `nil` when the test passed
+	Err      error
+	Output   string
+	Duration time.Duration
+}
+
+// Each file is parsed and resolved once, each of its tests runs the script again in a fresh
+// interpreter sharing the resolution, so the statements stay the same for the coverage
+type TestRunner struct {
+	timeout time.Duration
+	filter  *regexp.Regexp
+	// `nil` unless measuring the coverage of the tests
+	coverage *Coverage
+	results  []*TestResult
+}
+
+func NewTestRunner(timeout time.Duration) *TestRunner {
+	return &TestRunner{timeout: timeout}
+}
+
+func (r *TestRunner) WithFilter(filter *regexp.Regexp) *TestRunner {
+	r.filter = filter
+	return r
+}
+
+func (r *TestRunner) runFile(filePath string) {
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		r.results = append(r.results, &TestResult{File: filePath, Name: "(read)", Err: err})
+		return
+	}
+	var diagnostics bytes.Buffer
+	compiled := NewInterpreter()
+	stmts, err := compileSource(string(source), compiled, NewErrorReporter(&diagnostics), false)
+	if err != nil {
+		// The diagnostics explain the failure better than the error summing them up
+		if diagnostics.Len() > 0 {
+			err = errors.New(strings.TrimSpace(diagnostics.String()))
+		}
+		r.results = append(r.results, &TestResult{File: filePath, Name: "(compile)", Err: err})
+		return
+	}
+	if r.coverage != nil {
+		r.coverage.register(filePath, string(source), stmts)
+	}
+
+	for _, test := range findTests(stmts) {
+		if r.filter != nil && !r.filter.MatchString(test.Name) {
+			continue
+		}
+		result := r.runTest(compiled, stmts, test)
+		result.File = filePath
+		r.results = append(r.results, result)
+	}
+}
+
+func (r *TestRunner) runTest(compiled *Interpreter, stmts []Stmt, test *TestCase) *TestResult {
+	var output bytes.Buffer
+	interpreter := NewInterpreter().WithOutput(&output, &output)
+	interpreter.locals = compiled.locals
+	interpreter.config = compiled.config
+	interpreter.coverage = r.coverage
+	timer := time.AfterFunc(r.timeout, interpreter.Interrupt)
+	defer timer.Stop()
+
+	start := time.Now()
+	err := interpreter.interpret(stmts)
+	if err == nil && test.block != nil {
+		err = interpreter.execute(test.block)
+	} else if err == nil {
+		var function *Function
+		function, err = globalFunction(interpreter, test.function.name.Lexeme)
+		if err == nil {
+			_, err = function.call(interpreter, []any{})
+		}
+	}
+	if interpreter.IsInterrupted() {
+		err = fmt.Errorf("Test timed out after %v.", r.timeout)
+	}
+	return &TestResult{
+		Name:     test.Name,
+		Line:     test.Line,
+		Err:      err,
+		Output:   output.String(),
+		Duration: time.Since(start),
+	}
+}
+
+// The global [name] once the script ran, it was declared as a function without parameters
+// but a later declaration may have replaced it with anything
+func globalFunction(interpreter *Interpreter, name string) (*Function, error) {
+	function, ok := interpreter.globals[name].(*Function)
+	if !ok || function.arity() != 0 {
+		return nil, fmt.Errorf("%v is no longer a function without parameters.", name)
+	}
+	return function, nil
+}
+
+func writeTestText(out io.Writer, results []*TestResult, verbose bool) error {
+	var builder strings.Builder
+	failed := 0
+	for _, result := range results {
+		location := result.File
+		if result.Line > 0 {
+			location = fmt.Sprintf("%v:%d", result.File, result.Line)
+		}
+		if result.Err == nil {
+			if verbose {
+				fmt.Fprintf(&builder, "--- PASS: %v (%v, %v)\n", result.Name, location, result.Duration.Round(time.Microsecond))
+			}
+			continue
+		}
+		failed++
+		fmt.Fprintf(&builder, "--- FAIL: %v (%v, %v)\n", result.Name, location, result.Duration.Round(time.Microsecond))
+		builder.WriteString(indentLines(result.Err.Error(), "    "))
+		if result.Output != "" {
+			builder.WriteString("    output:\n")
+			builder.WriteString(indentLines(result.Output, "        "))
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(&builder, "FAIL: %d passed, %d failed.\n", len(results)-failed, failed)
+	} else {
+		fmt.Fprintf(&builder, "ok: %d passed.\n", len(results))
+	}
+	_, err := io.WriteString(out, builder.String())
+	return err
+}
+
+// Test Anything Protocol, the failures are described in YAML blocks
+func writeTap(out io.Writer, results []*TestResult) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "TAP version 13\n1..%d\n", len(results))
+	for i, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "not ok"
+		}
+		fmt.Fprintf(&builder, "%v %d - %v: %v\n", status, i+1, result.File, result.Name)
+		if result.Err == nil {
+			continue
+		}
+		builder.WriteString("  ---\n  message: |\n")
+		builder.WriteString(indentLines(result.Err.Error(), "    "))
+		fmt.Fprintf(&builder, "  at: %v:%d\n", result.File, result.Line)
+		if result.Output != "" {
+			builder.WriteString("  output: |\n")
+			builder.WriteString(indentLines(result.Output, "    "))
+		}
+		builder.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(out, builder.String())
+	return err
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit XML as read by CI servers, one suite per file
+func writeJUnit(out io.Writer, results []*TestResult) error {
+	report := junitSuites{}
+	suites := map[string]int{}
+	for _, result := range results {
+		index, ok := suites[result.File]
+		if !ok {
+			index = len(report.Suites)
+			suites[result.File] = index
+			report.Suites = append(report.Suites, junitSuite{Name: result.File})
+		}
+		suite := &report.Suites[index]
+		testCase := junitCase{
+			Name:      result.Name,
+			ClassName: strings.TrimSuffix(filepath.ToSlash(result.File), ".lox"),
+			Time:      junitSeconds(result.Duration),
+			SystemOut: result.Output,
+		}
+		if result.Err != nil {
+			message, _, _ := strings.Cut(result.Err.Error(), "\n")
+			testCase.Failure = &junitFailure{Message: message, Text: result.Err.Error()}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	for i := range report.Suites {
+		var total time.Duration
+		for _, result := range results {
+			if result.File == report.Suites[i].Name {
+				total += result.Duration
+			}
+		}
+		report.Suites[i].Time = junitSeconds(total)
+	}
+
+	_, err := io.WriteString(out, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+func indentLines(text, indent string) string {
+	var builder strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		builder.WriteString(indent + line + "\n")
+	}
+	return builder.String()
+}
@@ -1,12 +1,39 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+type TriviaKind int
+
+const (
+	// Consecutive spaces, tabs and carriage returns
+	TriviaWhitespace TriviaKind = iota
+	TriviaNewline
+	TriviaLineComment
+	TriviaBlockComment
+	// Text the scanner couldn't turn into a token, e.g. unexpected characters
+	TriviaSkipped
+)
+
+// Source text between tokens, only kept by a lossless scanner
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
 
 type Token struct {
 	Type    TokenType
 	Lexeme  string
 	Literal any
 	Line    int
+	// Byte offset of the lexeme in the source, `0` for tokens made up by the interpreter
+	Offset int
+	// Trivia on the lines before the token
+	LeadingTrivia []Trivia
+	// Trivia after the token up to and including the end of its line
+	TrailingTrivia []Trivia
 }
 
 func NewToken(tokenType TokenType, lexeme string, literal any, line int,
@@ -20,5 +47,23 @@ func NewToken(tokenType TokenType, lexeme string, literal any, line int,
 }
 
 func (t *Token) String() string {
+	if str, ok := t.Literal.([]byte); ok {
+		return fmt.Sprintf("%v %v %v", t.Type, t.Lexeme, string(str))
+	}
 	return fmt.Sprintf("%v %v %v", t.Type, t.Lexeme, t.Literal)
 }
+
+// Reproduces the source of the tokens of a lossless scanner
+func TokensSource(tokens []*Token) string {
+	var builder strings.Builder
+	for _, token := range tokens {
+		for _, trivia := range token.LeadingTrivia {
+			builder.WriteString(trivia.Text)
+		}
+		builder.WriteString(token.Lexeme)
+		for _, trivia := range token.TrailingTrivia {
+			builder.WriteString(trivia.Text)
+		}
+	}
+	return builder.String()
+}
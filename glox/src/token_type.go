@@ -64,8 +64,8 @@ const (
 	EOF
 )
 
-func (t *TokenType) String() string {
-	switch *t {
+func (t TokenType) String() string {
+	switch t {
 	case LeftParen:
 		return "LeftParen"
 	case RightParen:
@@ -92,6 +92,12 @@ func (t *TokenType) String() string {
 		return "Slash"
 	case Star:
 		return "Star"
+	case QuestionMark:
+		return "QuestionMark"
+	case Colon:
+		return "Colon"
+	case Percent:
+		return "Percent"
 	case Bang:
 		return "Bang"
 	case BangEqual:
@@ -146,6 +152,12 @@ func (t *TokenType) String() string {
 		return "Var"
 	case While:
 		return "While"
+	case Break:
+		return "Break"
+	case Continue:
+		return "Continue"
+	case Array:
+		return "Array"
 	case EOF:
 		return "EOF"
 	default:
@@ -2,22 +2,58 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io"
 )
 
-// For a more convenient wrapper use [printError]
-// Set global [hadError] to true and writes the error to stderr
-func report(line int, where, message string) {
-	hadError = true
-	fmt.Fprintf(os.Stderr, "[line %v] Error%v: %v\n", line, where, message)
+// Collects the errors of the scanner, parser and resolver for a single source
+type ErrorReporter struct {
+	out io.Writer
+	// To prevent interpreter execution on errors not triggering parser panic mode
+	hadError bool
+	// Everything written to [out], for tools that need the positions
+	Diagnostics []Diagnostic
 }
 
-// Set global [hadError] to true and writes the error to stderr
-func printError(token *Token, message string) {
+type Diagnostic struct {
+	// `nil` when only the line is known, e.g. for scanner errors
+	Token     *Token
+	Line      int
+	Message   string
+	IsWarning bool
+}
+
+func NewErrorReporter(out io.Writer) *ErrorReporter {
+	return &ErrorReporter{
+		out: out,
+	}
+}
+
+// For a more convenient wrapper use [ErrorReporter.printError]
+// Set [ErrorReporter.hadError] to true and writes the error to the reporter output
+func (r *ErrorReporter) report(line int, where, message string) {
+	r.hadError = true
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Line: line, Message: message})
+	fmt.Fprintf(r.out, "[line %v] Error%v: %v\n", line, where, message)
+}
+
+// Writes the warning to the reporter output, [ErrorReporter.hadError] is left untouched
+func (r *ErrorReporter) printWarning(token *Token, message string) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Token: token, Line: token.Line, Message: message, IsWarning: true})
+	if token.Type == EOF {
+		fmt.Fprintf(r.out, "[line %v] Warning at end: %v\n", token.Line, message)
+		return
+	}
+	fmt.Fprintf(r.out, "[line %v] Warning at '%v': %v\n", token.Line, token.Lexeme, message)
+}
+
+// Set [ErrorReporter.hadError] to true and writes the error to the reporter output
+func (r *ErrorReporter) printError(token *Token, message string) {
+	where := " at '" + token.Lexeme + "'"
 	if token.Type == EOF {
-		report(token.Line, " at end", message)
+		where = " at end"
 	}
-	report(token.Line, " at '"+token.Lexeme+"'", message)
+	r.report(token.Line, where, message)
+	r.Diagnostics[len(r.Diagnostics)-1].Token = token
 }
 
 func IsDigit(c byte) bool {
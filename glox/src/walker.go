@@ -0,0 +1,36 @@
+package main
+
+//go:generate go run generate_ast.go
+
+// Walks the tree under [node], a Stmt or an Expr, depth first in source order.
+// [pre] runs before the children and skips them by returning `false`, [post] runs after them,
+// either can be `nil`
+func Walk(node any, pre func(node any) bool, post func(node any)) {
+	if pre != nil && !pre(node) {
+		return
+	}
+	walkChildren(node, func(child any) {
+		Walk(child, pre, post)
+	})
+	if post != nil {
+		post(node)
+	}
+}
+
+// Rewrites the tree under [node] bottom up, [rewrite] returns the node replacing each node, or the node
+// itself to keep it. The nodes are changed in place and a replacement must have a type its parent accepts,
+// e.g. an Expr for an Expr
+func Rewrite(node any, rewrite func(node any) any) any {
+	rewriteChildren(node, func(child any) any {
+		return Rewrite(child, rewrite)
+	})
+	return rewrite(node)
+}
+
+func RewriteStmts(stmts []Stmt, rewrite func(node any) any) []Stmt {
+	rewritten := make([]Stmt, len(stmts))
+	for i, stmt := range stmts {
+		rewritten[i] = Rewrite(stmt, rewrite).(Stmt)
+	}
+	return rewritten
+}
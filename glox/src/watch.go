@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	watchPollInterval = 200 * time.Millisecond
+	// Editors often save in several writes, wait for the files to settle before running
+	watchDebounce = 150 * time.Millisecond
+	clearScreen   = "\033[H\033[2J"
+)
+
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Polled state of the watched files, no file system notifications are used
+type fileSnapshot map[string]fileState
+
+func takeFileSnapshot(filePaths []string) fileSnapshot {
+	snapshot := fileSnapshot{}
+	for _, filePath := range filePaths {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			snapshot[filePath] = fileState{}
+			continue
+		}
+		snapshot[filePath] = fileState{
+			exists:  true,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+	}
+	return snapshot
+}
+
+func (s fileSnapshot) equal(other fileSnapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for filePath, state := range s {
+		otherState, ok := other[filePath]
+		if !ok || state.exists != otherState.exists || state.size != otherState.size ||
+			!state.modTime.Equal(otherState.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lox has no imports so a script only depends on itself and on its project file
+// Every place a project file could be is watched so creating one is noticed too
+func watchedFiles(filePath string) []string {
+	files := []string{filePath}
+	dir, err := filepath.Abs(scriptDir(filePath))
+	if err != nil {
+		return files
+	}
+	for {
+		for _, name := range projectConfigNames {
+			files = append(files, filepath.Join(dir, name))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return files
+		}
+		dir = parent
+	}
+}
+
+// Runs the script with a fresh interpreter every time it changes, a run still going is interrupted
+func watchFile(filePath string) error {
+	files := watchedFiles(filePath)
+	snapshot := takeFileSnapshot(files)
+	for {
+		fmt.Print(clearScreen)
+		done := make(chan error, 1)
+		// The project file could have changed as well
+		err := setupConfig(filePath)
+		interpreter := NewInterpreter()
+		go func() {
+			if err != nil {
+				done <- err
+				return
+			}
+			done <- runFileWith(filePath, interpreter)
+		}()
+
+		isRunning := true
+		for {
+			select {
+			case err := <-done:
+				isRunning = false
+				reportWatchedRun(err)
+			case <-time.After(watchPollInterval):
+			}
+
+			current := takeFileSnapshot(files)
+			if !current.equal(snapshot) {
+				snapshot = waitForStableFiles(files, current)
+				break
+			}
+		}
+
+		if isRunning {
+			interpreter.Interrupt()
+			<-done
+		}
+	}
+}
+
+func waitForStableFiles(files []string, snapshot fileSnapshot) fileSnapshot {
+	for {
+		time.Sleep(watchDebounce)
+		current := takeFileSnapshot(files)
+		if current.equal(snapshot) {
+			return current
+		}
+		snapshot = current
+	}
+}
+
+func reportWatchedRun(err error) {
+	if err != nil && !isLoxError(err) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Fprintf(os.Stderr, "[watch] exited with code %v, waiting for changes...\n", watchExitCode(err))
+}
+
+func watchExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCode(err)
+}